@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	"github.com/cornelk/goscrape/scraper"
 	"github.com/spf13/cobra"
@@ -21,11 +26,32 @@ func main() {
 	rootCmd.Flags().StringArrayP("include", "n", nil, "only include URLs with PERL Regular Expressions support")
 	rootCmd.Flags().StringArrayP("exclude", "x", nil, "exclude URLs with PERL Regular Expressions support")
 	rootCmd.Flags().StringP("output", "o", "", "output directory to write files to")
+	rootCmd.Flags().String("archive", "", "zip file to write all files to instead of the output directory")
 	rootCmd.Flags().IntP("imagequality", "i", 0, "image quality, 0 to disable reencoding")
 	rootCmd.Flags().UintP("depth", "d", 10, "download depth, 0 for unlimited")
+	rootCmd.Flags().Int64("maxmediasize", 0, "max size in MB of audio, video and embedded files to download, 0 for unlimited")
 	rootCmd.Flags().UintP("timeout", "t", 0, "time limit in seconds for each http request to connect and read the request body")
+	rootCmd.Flags().UintP("concurrency", "c", 4, "number of pages to download concurrently")
+	rootCmd.Flags().Uint("assetconcurrency", 8, "number of assets to download concurrently")
+	rootCmd.Flags().Float64("ratelimit", 0, "max requests per second per host, 0 for unlimited")
+	rootCmd.Flags().Uint("hostconcurrency", 0, "max concurrent requests per host, 0 for unlimited")
+	rootCmd.Flags().Duration("jitter", 0, "max random delay to add before every request, for example 500ms")
+	rootCmd.Flags().UintP("retries", "r", 3, "number of retries for failed requests")
+	rootCmd.Flags().Duration("retrybackoff", scraper.DefaultRetryBackoff, "delay before the first retry, doubles for every further retry")
+	rootCmd.Flags().String("frontier", "bfs", "order of page downloads: bfs or priority (lowest depth and shortest path first)")
+	rootCmd.Flags().String("query", "keep", "handling of URL query strings: keep (URLs with different queries are different files) or drop")
+	rootCmd.Flags().StringArray("dropquery", []string{"utm_*"}, "pattern of query parameter names to ignore, can be repeated")
 	rootCmd.Flags().BoolP("verbose", "v", false, "verbose output")
+	rootCmd.Flags().Bool("resume", false, "resume a previous scrape from the checkpoint in the output directory")
+	rootCmd.Flags().Bool("dedup", false, "store identical assets only once and hardlink their files")
+	rootCmd.Flags().Bool("ignore-robots", false, "ignore robots.txt rules and crawl delays")
+	rootCmd.Flags().String("robotsagent", "", "user agent name to match robots.txt rules against (default is the product of the user agent)")
+	rootCmd.Flags().String("warc", "", "path prefix of WARC files to write all requests and responses to")
+	rootCmd.Flags().Int64("warcmaxsize", scraper.DefaultWARCMaxSize>>20, "size in MB after which a new WARC file is started")
+	rootCmd.Flags().Bool("sitemap", false, "also download the pages listed in /sitemap.xml and the sitemaps of robots.txt")
 	rootCmd.Flags().StringP("user", "u", "", "user[:password] to use for authentication")
+	rootCmd.Flags().StringP("useragent", "a", "", "user agent to send (default \""+scraper.DefaultUserAgent+"\")")
+	rootCmd.Flags().StringArrayP("header", "H", nil, "additional \"Name: value\" header to send with every request, can be repeated")
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Printf("ERROR: %v\n", err)
@@ -43,6 +69,7 @@ func startScraper(cmd *cobra.Command, args []string) {
 	viper.AutomaticEnv()             // read in environment variables that match
 
 	_ = viper.ReadInConfig()
+	_ = viper.BindPFlag("useragent", cmd.Flags().Lookup("useragent"))
 
 	if len(args) == 0 {
 		_ = cmd.Help()
@@ -59,6 +86,18 @@ func startScraper(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	// viper does not support string array flags, use the config file
+	// value only if the flag was not passed
+	headerParams, _ := cmd.Flags().GetStringArray("header")
+	if !cmd.Flags().Changed("header") {
+		headerParams = viper.GetStringSlice("header")
+	}
+	headers, err := parseHeaders(headerParams)
+	if err != nil {
+		fmt.Printf("ERROR: %v\n", err)
+		return
+	}
+
 	includes, _ := cmd.Flags().GetStringArray("include")
 	excludes, _ := cmd.Flags().GetStringArray("excludes")
 	imageQuality, _ := cmd.Flags().GetInt("imagequality")
@@ -68,32 +107,129 @@ func startScraper(cmd *cobra.Command, args []string) {
 	output, _ := cmd.Flags().GetString("output")
 	depth, _ := cmd.Flags().GetUint("depth")
 	timeout, _ := cmd.Flags().GetUint("timeout")
+	maxMediaSize, _ := cmd.Flags().GetInt64("maxmediasize")
+	concurrency, _ := cmd.Flags().GetUint("concurrency")
+	assetConcurrency, _ := cmd.Flags().GetUint("assetconcurrency")
+	frontier, _ := cmd.Flags().GetString("frontier")
+	query, _ := cmd.Flags().GetString("query")
+	dropQuery, _ := cmd.Flags().GetStringArray("dropquery")
+	rateLimit, _ := cmd.Flags().GetFloat64("ratelimit")
+	hostConcurrency, _ := cmd.Flags().GetUint("hostconcurrency")
+	jitter, _ := cmd.Flags().GetDuration("jitter")
+	retries, _ := cmd.Flags().GetUint("retries")
+	retryBackoff, _ := cmd.Flags().GetDuration("retrybackoff")
+	resume, _ := cmd.Flags().GetBool("resume")
+	dedup, _ := cmd.Flags().GetBool("dedup")
+	ignoreRobots, _ := cmd.Flags().GetBool("ignore-robots")
+	robotsAgent, _ := cmd.Flags().GetString("robotsagent")
+	sitemaps, _ := cmd.Flags().GetBool("sitemap")
+	warcPrefix, _ := cmd.Flags().GetString("warc")
+	warcMaxSize, _ := cmd.Flags().GetInt64("warcmaxsize")
+	archive, _ := cmd.Flags().GetString("archive")
 
 	logger := logger(cmd)
+
+	var storage *scraper.ArchiveStorage
+	if archive != "" {
+		if storage, err = scraper.NewArchiveStorage(archive); err != nil {
+			logger.Fatal("Opening archive failed", zap.Error(err))
+		}
+	}
+
 	cfg := scraper.Config{
-		Includes:        includes,
-		Excludes:        excludes,
-		ImageQuality:    uint(imageQuality),
-		MaxDepth:        depth,
-		Timeout:         timeout,
-		OutputDirectory: output,
-		Username:        username,
-		Password:        password,
+		Includes:         includes,
+		Excludes:         excludes,
+		ImageQuality:     uint(imageQuality),
+		MaxDepth:         depth,
+		MaxMediaSize:     maxMediaSize << 20,
+		Timeout:          timeout,
+		UserAgent:        viper.GetString("useragent"),
+		Headers:          headers,
+		Concurrency:      concurrency,
+		AssetConcurrency: assetConcurrency,
+		Frontier:         scraper.FrontierMode(frontier),
+		Query:            scraper.QueryMode(query),
+		DropQueryParams:  dropQuery,
+		RateLimit:        rateLimit,
+		HostConcurrency:  hostConcurrency,
+		Jitter:           jitter,
+		MaxRetries:       retries,
+		RetryBackoff:     retryBackoff,
+		OutputDirectory:  output,
+		Username:         username,
+		Password:         password,
+		Resume:           resume,
+		Deduplicate:      dedup,
+		IgnoreRobots:     ignoreRobots,
+		RobotsAgent:      robotsAgent,
+		Sitemaps:         sitemaps,
+		WARCPrefix:       warcPrefix,
+		WARCMaxSize:      warcMaxSize << 20,
 	}
+	if storage != nil {
+		cfg.Storage = storage
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopOnSignal(logger, cancel)
 
 	for _, url := range args {
 		cfg.URL = url
 		sc, err := scraper.New(logger, cfg)
 		if err != nil {
-			logger.Fatal("Initializing scraper failed", zap.Error(err))
+			// exiting here would not write the archive of the URLs that
+			// were scraped already
+			logger.Error("Initializing scraper failed",
+				zap.String("URL", url),
+				zap.Error(err))
+			continue
 		}
 
 		logger.Info("Scraping", zap.Stringer("URL", sc.URL))
-		err = sc.Start()
+		err = sc.StartContext(ctx)
 		if err != nil {
 			logger.Error("Scraping failed", zap.Error(err))
 		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if storage != nil {
+		if err = storage.Close(); err != nil {
+			logger.Error("Writing archive failed", zap.Error(err))
+		}
+	}
+}
+
+// stopOnSignal cancels the scrape on the first interrupt or terminate
+// signal to shut down gracefully and exits on the second one.
+func stopOnSignal(logger *zap.Logger, cancel context.CancelFunc) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		logger.Info("Stopping, press Ctrl+C again to exit immediately")
+		cancel()
+		<-signals
+		os.Exit(1)
+	}()
+}
+
+// parseHeaders parses a list of "Name: value" header lines.
+func parseHeaders(lines []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, line := range lines {
+		sl := strings.SplitN(line, ":", 2)
+		name := strings.TrimSpace(sl[0])
+		if len(sl) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected format is \"Name: value\"", line)
+		}
+		headers.Add(name, strings.TrimSpace(sl[1]))
 	}
+	return headers, nil
 }
 
 func logger(cmd *cobra.Command) *zap.Logger {
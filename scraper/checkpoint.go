@@ -0,0 +1,169 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// CheckpointFile is the file name of the checkpoint that gets written
+	// to the directory of the website host while scraping.
+	CheckpointFile = ".goscrape-checkpoint.json"
+
+	checkpointInterval = 10 * time.Second
+)
+
+// checkpoint contains the state of a running scrape that is needed to
+// resume it.
+type checkpoint struct {
+	URL       string           `json:"url"`
+	Pages     []checkpointPage `json:"pages"`
+	Depths    map[string]uint  `json:"depths"`
+	Assets    []storedAsset    `json:"assets"`
+	Processed []string         `json:"processed"`
+}
+
+type checkpointPage struct {
+	URL   string `json:"url"`
+	Depth uint   `json:"depth"`
+}
+
+// writeCheckpoints writes a checkpoint periodically until the stop channel
+// gets closed.
+func (s *Scraper) writeCheckpoints(stop <-chan struct{}) {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := s.writeCheckpoint(); err != nil {
+				s.log.Error("Writing checkpoint failed", zap.Error(err))
+			}
+			if err := s.writeValidators(); err != nil {
+				s.log.Error("Writing validators failed", zap.Error(err))
+			}
+			if err := s.writePaths(); err != nil {
+				s.log.Error("Writing paths failed", zap.Error(err))
+			}
+		}
+	}
+}
+
+// writeCheckpoint writes the current state of the scrape to the checkpoint
+// file. The frontier has to be saved before the pending assets and the
+// pending assets before the processed set, this way no asset that was
+// queued by a finished page can be missing.
+func (s *Scraper) writeCheckpoint() error {
+	pages, depths := s.pages.snapshot()
+
+	c := checkpoint{
+		URL:    s.URL.String(),
+		Pages:  make([]checkpointPage, 0, len(pages)),
+		Depths: depths,
+	}
+	for _, page := range pages {
+		c.Pages = append(c.Pages, checkpointPage{URL: page.URL.String(), Depth: page.depth})
+	}
+
+	s.pendingAssetsMu.Lock()
+	for u, kind := range s.pendingAssets {
+		c.Assets = append(c.Assets, storedAsset{URL: u, Kind: kind})
+	}
+	s.pendingAssetsMu.Unlock()
+
+	// failed downloads get retried when resuming
+	s.failedMu.Lock()
+	for _, page := range s.failedPages {
+		c.Pages = append(c.Pages, checkpointPage{URL: page.URL.String(), Depth: page.depth})
+	}
+	for u, kind := range s.failedAssets {
+		c.Assets = append(c.Assets, storedAsset{URL: u, Kind: kind})
+	}
+	s.failedMu.Unlock()
+
+	c.Processed = s.processed.keys()
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	// the storage writes atomically, a killed process does not leave a
+	// broken checkpoint behind
+	return s.storage.Write(s.checkpointName(), b)
+}
+
+// loadCheckpoint restores the state of a previous scrape from the checkpoint
+// file and queues all pages and assets that were not finished. It returns
+// false if no checkpoint exists.
+func (s *Scraper) loadCheckpoint() (bool, error) {
+	b, err := s.storage.Read(s.checkpointName())
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.log.Info("No checkpoint found, starting a new scrape")
+			return false, nil
+		}
+		return false, err
+	}
+
+	var c checkpoint
+	if err = json.Unmarshal(b, &c); err != nil {
+		return false, err
+	}
+
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return false, err
+	}
+	s.URL = u
+
+	for _, key := range c.Processed {
+		s.processed.add(key)
+	}
+	s.pages.restoreDepths(c.Depths)
+
+	for _, page := range c.Pages {
+		u, err := url.Parse(page.URL)
+		if err != nil {
+			return false, err
+		}
+		s.jobs.Add(1)
+		if !s.pages.restore(s.pageKey(u), u, page.Depth) {
+			s.jobs.Done()
+		}
+	}
+
+	for _, asset := range c.Assets {
+		u, err := url.Parse(asset.URL)
+		if err != nil {
+			return false, err
+		}
+		// assets that were being downloaded are part of the processed set
+		s.processed.remove(asset.URL)
+		s.queueAsset(u, asset.Kind)
+	}
+
+	s.log.Info("Resuming scrape from checkpoint",
+		zap.Int("pages", len(c.Pages)),
+		zap.Int("assets", len(c.Assets)))
+	return true, nil
+}
+
+// removeCheckpoint removes the checkpoint file of a finished scrape.
+func (s *Scraper) removeCheckpoint() error {
+	return s.storage.Remove(s.checkpointName())
+}
+
+// checkpointName returns the storage file name of the checkpoint. Every
+// website host has its own checkpoint, resuming the scrape of a website
+// does not pick up the checkpoint of another one in the output directory.
+func (s *Scraper) checkpointName() string {
+	return path.Join(s.stateDirectory, CheckpointFile)
+}
@@ -0,0 +1,247 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestResumeFromCheckpoint(t *testing.T) {
+	site := testSite{
+		"/":         `<html><body><a href="a">a</a><a href="b">b</a></body></html>`,
+		"/a":        `<html><body>a</body></html>`,
+		"/b":        `<html><body><a href="c">c</a></body></html>`,
+		"/c":        `<html><body>c</body></html>`,
+		"/app.js":   "app",
+		"/style.js": "style",
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	c := checkpoint{
+		URL:       server.URL,
+		Pages:     []checkpointPage{{URL: server.URL + "/b", Depth: 1}},
+		Depths:    map[string]uint{"/": 0, "/a": 1, "/b": 1},
+		Assets:    []storedAsset{{URL: server.URL + "/app.js", Kind: assetPlain}},
+		Processed: []string{server.URL + "/app.js", server.URL + "/style.js"},
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Encoding checkpoint failed: %v", err)
+	}
+	cfg := Config{
+		URL:             server.URL,
+		OutputDirectory: output,
+		Resume:          true,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	if err = s.storage.Write(s.checkpointName(), b); err != nil {
+		t.Fatalf("Writing checkpoint failed: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("Scraping failed: %v", err)
+	}
+
+	dir := filepath.Join(output, s.hostDirectory())
+	// finished pages and processed assets are not downloaded again
+	assertStored(t, dir, "b.html", "c.html", "app.js")
+	assertNotStored(t, dir, "index.html", "a.html", "style.js")
+	// the checkpoint of the finished scrape is removed
+	assertNotStored(t, dir, CheckpointFile)
+}
+
+func TestResumeIgnoresCheckpointOfOtherHost(t *testing.T) {
+	other := httptest.NewServer(testSite{"/": `<html><body>other</body></html>`})
+	defer other.Close()
+	site := testSite{
+		"/":  `<html><body><a href="a">a</a></body></html>`,
+		"/a": `<html><body>a</body></html>`,
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	// checkpoint of a cancelled scrape of the other website
+	otherScraper, err := New(zaptest.NewLogger(t), Config{URL: other.URL, OutputDirectory: output})
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	c := checkpoint{
+		URL:    other.URL,
+		Pages:  []checkpointPage{{URL: other.URL + "/", Depth: 0}},
+		Depths: map[string]uint{"/": 0},
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Encoding checkpoint failed: %v", err)
+	}
+	if err = otherScraper.storage.Write(otherScraper.checkpointName(), b); err != nil {
+		t.Fatalf("Writing checkpoint failed: %v", err)
+	}
+
+	dir := scrapeTestURL(t, server.URL, Config{Resume: true}, output)
+	assertStored(t, dir, "index.html", "a.html")
+	// the checkpoint of the other website is neither resumed nor removed
+	assertNotStored(t, filepath.Join(output, otherScraper.hostDirectory()), "index.html")
+	assertStored(t, output, otherScraper.checkpointName())
+}
+
+// blockingSite serves a test site and blocks requests of one path until
+// they get cancelled while blocking is enabled.
+type blockingSite struct {
+	site     testSite
+	path     string
+	blocking int32
+	started  chan struct{}
+	once     sync.Once
+}
+
+func (b *blockingSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == b.path && atomic.LoadInt32(&b.blocking) == 1 {
+		b.once.Do(func() {
+			close(b.started)
+		})
+		<-r.Context().Done()
+		return
+	}
+	b.site.ServeHTTP(w, r)
+}
+
+func TestCancelAndResume(t *testing.T) {
+	site := &blockingSite{
+		site: testSite{
+			"/":  `<html><body><a href="a">a</a><a href="b">b</a></body></html>`,
+			"/a": `<html><body><a href="c">c</a></body></html>`,
+			"/b": `<html><body>b</body></html>`,
+			"/c": `<html><body>c</body></html>`,
+		},
+		path:     "/b",
+		blocking: 1,
+		started:  make(chan struct{}),
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		URL:             server.URL,
+		OutputDirectory: output,
+		Concurrency:     1,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-site.started
+		cancel()
+	}()
+
+	err = s.StartContext(ctx)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("Cancelled scrape should return the context error but got %v", err)
+	}
+
+	dir := filepath.Join(output, s.hostDirectory())
+	assertNotStored(t, dir, "b.html", "c.html")
+
+	b, err := ioutil.ReadFile(filepath.Join(dir, CheckpointFile))
+	if err != nil {
+		t.Fatalf("Checkpoint of cancelled scrape was not written: %v", err)
+	}
+	var c checkpoint
+	if err = json.Unmarshal(b, &c); err != nil {
+		t.Fatalf("Decoding checkpoint failed: %v", err)
+	}
+	if len(c.Pages) != 2 {
+		t.Errorf("Checkpoint should contain the 2 unfinished pages but had %v", c.Pages)
+	}
+
+	atomic.StoreInt32(&site.blocking, 0)
+	cfg.Resume = true
+	s, err = New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("Resuming scrape failed: %v", err)
+	}
+	assertStored(t, dir, "index.html", "a.html", "b.html", "c.html")
+}
+
+func TestResumeKeepsURLOfRedirectedStartPage(t *testing.T) {
+	site := testSite{
+		"/new/": `<html><body>new</body></html>`,
+		"/a":    `<html><body><a href="c">c</a></body></html>`,
+		"/c":    `<html><body>c</body></html>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/new/", http.StatusFound)
+			return
+		}
+		site.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		URL:             server.URL + "/",
+		OutputDirectory: output,
+		Resume:          true,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	// the start page runs concurrently with the other resumed pages
+	c := checkpoint{
+		URL: server.URL + "/",
+		Pages: []checkpointPage{
+			{URL: server.URL + "/", Depth: 0},
+			{URL: server.URL + "/a", Depth: 1},
+		},
+		Depths: map[string]uint{"/": 0, "/a": 1},
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Encoding checkpoint failed: %v", err)
+	}
+	if err = s.storage.Write(s.checkpointName(), b); err != nil {
+		t.Fatalf("Writing checkpoint failed: %v", err)
+	}
+	if err = s.Start(); err != nil {
+		t.Fatalf("Scraping failed: %v", err)
+	}
+
+	if s.URL.String() != server.URL+"/" {
+		t.Errorf("URL of the resumed scrape should not change but was %s", s.URL)
+	}
+	dir := filepath.Join(output, s.hostDirectory())
+	assertStored(t, dir, "index.html", "a.html", "c.html")
+}
@@ -1,27 +1,38 @@
 package scraper
 
 import (
+	"context"
 	"net/url"
 
 	"go.uber.org/zap"
 )
 
-// checkPageURL checks if a page should be downloaded
-func (s *Scraper) checkPageURL(url *url.URL, currentDepth uint) bool {
+// pageKey returns the key that identifies a page in the frontier, it
+// contains the significant query parameters of the URL.
+func (s *Scraper) pageKey(url *url.URL) string {
+	p := url.Path
+	if p == "" {
+		p = "/"
+	}
+	if query := s.canonicalQuery(url); query != "" {
+		p += "?" + query
+	}
+	return p
+}
+
+// checkPageURL checks if a page should be downloaded at the given depth
+func (s *Scraper) checkPageURL(ctx context.Context, url *url.URL, depth uint) bool {
 	if url.Scheme != "http" && url.Scheme != "https" {
 		return false
 	}
 	if url.Host != s.URL.Host {
 		s.log.Debug("Skipping external host page", zap.Stringer("URL", url))
+		s.onSkip(url, SkipExternal)
 		return false
 	}
 
-	p := url.Path
-	if p == "" {
-		p = "/"
-	}
-
-	if _, ok := s.processed[p]; ok { // was already downloaded or checked
+	p := s.pageKey(url)
+	if s.pages.discovered(p, depth) { // was already downloaded or checked
 		if url.Fragment != "" {
 			return false
 		}
@@ -29,16 +40,30 @@ func (s *Scraper) checkPageURL(url *url.URL, currentDepth uint) bool {
 		return false
 	}
 
-	s.processed[p] = struct{}{}
-	if s.config.MaxDepth != 0 && currentDepth == s.config.MaxDepth {
+	if s.config.MaxDepth != 0 && depth > s.config.MaxDepth {
 		s.log.Debug("Skipping too deep level page", zap.Stringer("URL", url))
+		s.onSkip(url, SkipDepth)
 		return false
 	}
 
 	if s.includes != nil && !s.isURLIncluded(url) {
+		s.pages.reject(p)
+		s.onSkip(url, SkipExcluded)
 		return false
 	}
 	if s.excludes != nil && s.isURLExcluded(url) {
+		s.pages.reject(p)
+		s.onSkip(url, SkipExcluded)
+		return false
+	}
+	allowed, err := s.isAllowedByRobots(ctx, url)
+	if err != nil {
+		return false // the scrape got cancelled
+	}
+	if !allowed {
+		s.log.Debug("Skipping page disallowed by robots.txt", zap.Stringer("URL", url))
+		s.pages.reject(p)
+		s.onSkip(url, SkipRobots)
 		return false
 	}
 
@@ -77,3 +102,39 @@ func (s *Scraper) isURLExcluded(url *url.URL) bool {
 	}
 	return false
 }
+
+// isAllowedByRobots returns whether the robots.txt file of the URL host
+// allows downloading the URL. It returns the error of the context if it got
+// cancelled before the robots.txt file was downloaded.
+func (s *Scraper) isAllowedByRobots(ctx context.Context, url *url.URL) (bool, error) {
+	if s.robots == nil {
+		return true, nil
+	}
+	return s.robots.allowed(ctx, url)
+}
+
+// waitForRequest blocks until a request to the URL may be sent according to
+// the rate limits and if crawlDelay is set the crawl delay of the robots.txt
+// file of the URL host. The returned function has to be called once the
+// request finished.
+func (s *Scraper) waitForRequest(ctx context.Context, url *url.URL, crawlDelay bool) (func(), error) {
+	if s.robots != nil && crawlDelay {
+		// the robots.txt file is downloaded before taking the slot of the
+		// host, its request would otherwise wait for the slot itself
+		if _, err := s.robots.host(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+
+	release, err := s.limiter.acquire(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if s.robots != nil && crawlDelay {
+		if err = s.robots.wait(ctx, url); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,125 @@
+package scraper
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/h2non/filetype"
+	"github.com/h2non/filetype/types"
+	"go.uber.org/zap"
+)
+
+// pageExtensions contains the file extensions of URLs that are expected to
+// return HTML pages.
+var pageExtensions = map[string]struct{}{
+	".asp":   {},
+	".aspx":  {},
+	".cfm":   {},
+	".cgi":   {},
+	".htm":   {},
+	".html":  {},
+	".jsp":   {},
+	".php":   {},
+	".pl":    {},
+	".shtml": {},
+	".xhtml": {},
+}
+
+// contentTypeExtensions contains the file extensions for content types that
+// can not be detected by inspecting the content.
+var contentTypeExtensions = map[string]string{
+	"application/javascript": ".js",
+	"application/json":       ".json",
+	"application/xml":        ".xml",
+	"text/css":               ".css",
+	"text/csv":               ".csv",
+	"text/javascript":        ".js",
+	"text/plain":             ".txt",
+	"text/xml":               ".xml",
+}
+
+// isDownloadLink returns whether a link URL is expected to reference a file
+// that is not a HTML page, based on the file extension of the URL. Links to
+// external websites are not downloaded and always handled as pages.
+func (s *Scraper) isDownloadLink(u *url.URL) bool {
+	if u.Host != s.URL.Host {
+		return false
+	}
+	ext := strings.ToLower(path.Ext(u.Path))
+	if ext == "" {
+		return false
+	}
+	if _, ok := pageExtensions[ext]; ok {
+		return false
+	}
+	return filetype.IsSupported(ext[1:]) || mime.TypeByExtension(ext) != ""
+}
+
+// contentFileType returns whether a downloaded link target is a HTML page,
+// based on its content type and content. For other files the file
+// extension for the type is returned, if it is known.
+func contentFileType(contentType string, body []byte) (bool, string) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" || mediaType == "application/octet-stream" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	if mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		return true, ""
+	}
+
+	if kind, err := filetype.Match(body); err == nil && kind != types.Unknown {
+		return false, "." + kind.Extension
+	}
+	if ext, ok := contentTypeExtensions[mediaType]; ok {
+		return false, ext
+	}
+	if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+		return false, exts[0]
+	}
+	return false, ""
+}
+
+// downloadURL returns the URL of the file that a linked download gets
+// stored as. Links that are expected to reference a download keep their
+// path, for other links the page file path gets the extension of the type.
+func (s *Scraper) downloadURL(u *url.URL, ext string) *url.URL {
+	if s.isDownloadLink(u) {
+		return u
+	}
+	file := *u
+	file.Path = strings.TrimSuffix(GetPageFilePath(u), PageExtension) + ext
+	return &file
+}
+
+// storeDownload stores a linked file that is not a HTML page. If the links
+// to the file were relinked to a page file path, a redirect stub is
+// written at that path.
+func (s *Scraper) storeDownload(u, file *url.URL, buf *bytes.Buffer) {
+	if file != u {
+		s.writeRedirectStub(u, file, false)
+	}
+
+	buf, err := s.process(ContentOther, u, buf)
+	if err != nil {
+		s.log.Error("Processing download failed",
+			zap.Stringer("URL", u),
+			zap.Error(err))
+		s.recordError(u, err)
+		return
+	}
+
+	filePath := s.storageName(file, false)
+	if err := s.writeAsset(filePath, buf); err != nil {
+		s.log.Error("Writing download to file failed",
+			zap.Stringer("URL", u),
+			zap.String("file", filePath),
+			zap.Error(err))
+		s.recordError(u, err)
+		return
+	}
+	s.onAssetStored(u, filePath)
+}
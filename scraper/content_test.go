@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+const (
+	testPDF = "%PDF-1.4\n%test"
+	testZIP = "PK\x03\x04\x14\x00\x00\x00\x00\x00"
+	testPNG = "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+)
+
+func TestIsDownloadLink(t *testing.T) {
+	s, err := New(zaptest.NewLogger(t), Config{URL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	var fixtures = map[string]bool{
+		"http://localhost/":              false,
+		"http://localhost/page":          false,
+		"http://localhost/page.html":     false,
+		"http://localhost/index.php?a=1": false,
+		"http://localhost/v1.2":          false,
+		"http://localhost/report.pdf":    true,
+		"http://localhost/archive.ZIP":   true,
+		"http://localhost/photo.jpg":     true,
+		"http://example.org/report.pdf":  false,
+	}
+
+	for input, expected := range fixtures {
+		u, _ := url.Parse(input)
+		if res := s.isDownloadLink(u); res != expected {
+			t.Errorf("URL %s should have download link result %v but was %v", input, expected, res)
+		}
+	}
+}
+
+func TestContentFileType(t *testing.T) {
+	type result struct {
+		isPage bool
+		ext    string
+	}
+	var fixtures = []struct {
+		contentType string
+		body        string
+		expected    result
+	}{
+		{"text/html; charset=utf-8", "<html></html>", result{true, ""}},
+		{"", "<!DOCTYPE html><html></html>", result{true, ""}},
+		{"application/octet-stream", testPDF, result{false, ".pdf"}},
+		{"application/pdf", testPDF, result{false, ".pdf"}},
+		{"application/zip", testZIP, result{false, ".zip"}},
+		{"text/plain", "plain text", result{false, ".txt"}},
+		{"application/json", "{}", result{false, ".json"}},
+	}
+
+	for _, fixture := range fixtures {
+		isPage, ext := contentFileType(fixture.contentType, []byte(fixture.body))
+		if res := (result{isPage, ext}); res != fixture.expected {
+			t.Errorf("Content type %s should have been detected as %v but was %v", fixture.contentType, fixture.expected, res)
+		}
+	}
+}
+
+func TestScrapeDownloadLinks(t *testing.T) {
+	site := testSite{
+		"/": `<html><body><a href="docs/report.pdf">pdf</a><a href="download">zip</a>
+			<a href="photo.php">photo</a><a href="notes">notes</a></body></html>`,
+		"/docs/report.pdf": testPDF,
+		"/download":        testZIP,
+		"/photo.php":       testPNG,
+		"/notes":           "plain text notes",
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/notes" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		}
+		site.ServeHTTP(w, r)
+	})
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, handler, Config{}, output)
+
+	files := map[string]string{
+		"docs/report.pdf": testPDF,
+		"download.zip":    testZIP,
+		"photo.png":       testPNG,
+		"notes.txt":       "plain text notes",
+	}
+	for file, content := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Errorf("File %s was not stored: %v", file, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("File %s has unexpected content %q", file, data)
+		}
+	}
+
+	stubs := map[string]string{
+		"download.html": "url=download.zip",
+		"photo.html":    "url=photo.png",
+		"notes.html":    "url=notes.txt",
+	}
+	for file, refresh := range stubs {
+		assertContains(t, filepath.Join(dir, file), refresh)
+	}
+	// the download link is not relinked as a page
+	assertContains(t, filepath.Join(dir, "index.html"), `href="docs/report.pdf"`)
+}
@@ -8,51 +8,123 @@ import (
 	"strings"
 
 	"github.com/gorilla/css/scanner"
-	"github.com/headzoo/surf/browser"
 	"go.uber.org/zap"
 )
 
-func (s *Scraper) checkCSSForUrls(url *url.URL, buf *bytes.Buffer) *bytes.Buffer {
-	m := make(map[string]string)
+func (s *Scraper) checkCSSForUrls(url *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error) {
+	cssPath := *url
+	cssPath.Path = path.Dir(cssPath.Path) + "/"
+
 	str := buf.String()
+	refs := s.cssReferences(url, str)
+	for _, ref := range refs {
+		s.queueReference(ref.URL, ref.kind)
+	}
+	fixed := s.fixCSSReferences(&cssPath, str, refs, "")
+	if fixed == str {
+		return buf, nil
+	}
+	return bytes.NewBufferString(fixed), nil
+}
+
+// cssImageExtensions contains the file extensions of url() references that
+// are downloaded as images, references without extension are handled as
+// images as well.
+var cssImageExtensions = map[string]struct{}{
+	"":      {},
+	".avif": {},
+	".bmp":  {},
+	".gif":  {},
+	".ico":  {},
+	".jpeg": {},
+	".jpg":  {},
+	".png":  {},
+	".svg":  {},
+	".webp": {},
+}
+
+// cssAssetKind returns the asset kind of a url() reference, fonts and other
+// files are downloaded as plain assets.
+func cssAssetKind(u *url.URL) assetKind {
+	ext := strings.ToLower(path.Ext(u.Path))
+	if _, ok := cssImageExtensions[ext]; ok {
+		return assetImage
+	}
+	return assetPlain
+}
+
+// cssReference is an asset that a url() reference or an @import rule of CSS
+// content references.
+type cssReference struct {
+	token string // token of the reference in the content
+	URL   *url.URL
+	kind  assetKind
+}
+
+// cssReferences returns the assets that the url() references and @import
+// rules of the CSS content reference, resolved against the base URL.
+func (s *Scraper) cssReferences(base *url.URL, str string) []cssReference {
+	var refs []cssReference
 	css := scanner.New(str)
+	var importRule bool // the last token started an @import rule
 
 	for {
 		token := css.Next()
 		if token.Type == scanner.TokenEOF || token.Type == scanner.TokenError {
 			break
 		}
-		if token.Type != scanner.TokenURI {
-			continue
-		}
 
-		match := s.cssURLRe.FindStringSubmatch(token.Value)
-		if match == nil {
+		var src string
+		isImport := importRule
+		switch token.Type {
+		case scanner.TokenAtKeyword:
+			importRule = strings.EqualFold(token.Value, "@import")
+			continue
+		case scanner.TokenS, scanner.TokenComment:
+			continue
+		case scanner.TokenString:
+			importRule = false
+			if !isImport {
+				continue
+			}
+			src = token.Value[1 : len(token.Value)-1] // remove quotes
+		case scanner.TokenURI:
+			importRule = false
+			match := s.cssURLRe.FindStringSubmatch(token.Value)
+			if match == nil {
+				continue
+			}
+			src = match[1]
+		default:
+			importRule = false
 			continue
 		}
 
-		src := match[1]
 		if strings.HasPrefix(strings.ToLower(src), "data:") {
 			continue // skip embedded data
 		}
 
 		u, err := url.Parse(src)
 		if err != nil {
-			return buf
+			continue
 		}
-		u = url.ResolveReference(u)
-
-		img := browser.NewImageAsset(u, "", "", "")
-		s.imagesQueue = append(s.imagesQueue, &img.DownloadableAsset)
+		u = base.ResolveReference(u)
 
-		cssPath := *url
-		cssPath.Path = path.Dir(cssPath.Path) + "/"
-		resolved := s.resolveURL(&cssPath, src, false, "")
-		m[token.Value] = resolved
+		kind := cssAssetKind(u)
+		if isImport {
+			kind = assetStylesheet
+		}
+		refs = append(refs, cssReference{token: token.Value, URL: u, kind: kind})
 	}
+	return refs
+}
 
-	if len(m) == 0 {
-		return buf
+// fixCSSReferences returns the CSS content with the references relinked
+// relative to the link base URL.
+func (s *Scraper) fixCSSReferences(linkBase *url.URL, str string, refs []cssReference, relativeToRoot string) string {
+	m := make(map[string]string)
+	for _, ref := range refs {
+		m[ref.token] = s.resolveURL(linkBase, ref.URL.String(), false, relativeToRoot)
 	}
 
 	for ori, filePath := range m {
@@ -63,5 +135,5 @@ func (s *Scraper) checkCSSForUrls(url *url.URL, buf *bytes.Buffer) *bytes.Buffer
 			zap.String("fixed_url", fixed))
 	}
 
-	return bytes.NewBufferString(str)
+	return str
 }
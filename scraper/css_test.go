@@ -3,6 +3,8 @@ package scraper
 import (
 	"bytes"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"go.uber.org/zap/zaptest"
@@ -37,7 +39,7 @@ func TestCheckCSSForURLs(t *testing.T) {
 
 		if expected == "" {
 			if len(s.imagesQueue) != 0 {
-				t.Errorf("CSS %s should not result in an image in queue with URL %s", input, s.imagesQueue[0].URL.String())
+				t.Errorf("CSS %s should not result in an image in queue with URL %s", input, s.imagesQueue[0].String())
 			}
 			continue
 		}
@@ -46,9 +48,75 @@ func TestCheckCSSForURLs(t *testing.T) {
 			t.Errorf("CSS %s did not result in an image in queue", input)
 		}
 
-		res := s.imagesQueue[0].URL.String()
+		res := s.imagesQueue[0].String()
 		if res != expected {
 			t.Errorf("URL %s should have been %s but was %s", input, expected, res)
 		}
 	}
 }
+
+func TestScrapeInlineCSS(t *testing.T) {
+	site := testSite{
+		"/": `<html><body><a href="a/">a</a></body></html>`,
+		"/a/": `<html><head><style>
+			body { background: url("bg.png"); }
+			.logo { background-image: url('/img/logo.png'); }
+			</style></head><body>
+			<div style="background: url(/img/div.png) no-repeat">div</div>
+			<span style="background: url(data:image/gif;base64,R0lGODl)">span</span>
+			</body></html>`,
+		"/a/bg.png":     "bg",
+		"/img/logo.png": "logo",
+		"/img/div.png":  "div",
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, Config{}, output)
+
+	assertStored(t, dir, "a/bg.png", "img/logo.png", "img/div.png")
+	assertContains(t, filepath.Join(dir, "a", "index.html"),
+		"url(bg.png)",
+		"url(../img/logo.png)",
+		"url(../img/div.png)",
+		"url(data:image/gif;base64,R0lGODl)",
+	)
+}
+
+func TestScrapeCSSImports(t *testing.T) {
+	site := testSite{
+		"/": `<html><head><link rel="stylesheet" href="css/main.css"></head><body></body></html>`,
+		"/css/main.css": `@import "base.css";
+			@import url('/theme/theme.css') screen;
+			@font-face { font-family: Test; src: url(../fonts/test.woff2) format("woff2"); }`,
+		"/css/base.css":     `@import "main.css"; body { background: url(bg.png); }`,
+		"/theme/theme.css":  `h1 { background: url(title.jpg); }`,
+		"/fonts/test.woff2": "font",
+		"/css/bg.png":       "bg",
+		"/theme/title.jpg":  "title",
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, Config{}, output)
+
+	assertStored(t, dir, "css/base.css", "theme/theme.css", "fonts/test.woff2", "css/bg.png", "theme/title.jpg")
+	assertContains(t, filepath.Join(dir, "css", "main.css"),
+		"@import url(base.css);", "@import url(../theme/theme.css) screen;", "url(../fonts/test.woff2)")
+}
+
+func TestCSSAssetKind(t *testing.T) {
+	var fixtures = map[string]assetKind{
+		"http://localhost/bg.png":             assetImage,
+		"http://localhost/image":              assetImage,
+		"http://localhost/icon.SVG?v=1":       assetImage,
+		"http://localhost/font.woff2":         assetPlain,
+		"http://localhost/font.ttf#iefix":     assetPlain,
+		"http://localhost/cursor.cur?version": assetPlain,
+	}
+
+	for input, expected := range fixtures {
+		u, _ := url.Parse(input)
+		if kind := cssAssetKind(u); kind != expected {
+			t.Errorf("URL %s should have kind %s but has %s", input, expected, kind)
+		}
+	}
+}
@@ -2,73 +2,407 @@ package scraper
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
-	"os"
+	"strings"
 
-	"github.com/headzoo/surf/browser"
+	"github.com/PuerkitoBio/goquery"
 	"go.uber.org/zap"
 )
 
-// assetProcessor is a processor of a downloaded asset that can transform
-// a downloaded file content before it will be stored on disk.
-type assetProcessor func(URL *url.URL, buf *bytes.Buffer) *bytes.Buffer
+// assetKind defines which processors handle a downloaded asset.
+type assetKind string
 
-func (s *Scraper) downloadReferences() {
-	for _, image := range s.browser.Images() {
-		s.imagesQueue = append(s.imagesQueue, &image.DownloadableAsset)
+const (
+	assetPlain      assetKind = "plain"
+	assetStylesheet assetKind = "stylesheet"
+	assetScript     assetKind = "script"
+	assetImage      assetKind = "image"
+	assetMedia      assetKind = "media"
+)
+
+// contentType returns the content type of the processors that handle
+// assets of the kind.
+func (k assetKind) contentType() ContentType {
+	switch k {
+	case assetStylesheet:
+		return ContentCSS
+	case assetScript:
+		return ContentJS
+	case assetImage:
+		return ContentImage
+	default:
+		return ContentOther
 	}
-	for _, stylesheet := range s.browser.Stylesheets() {
-		s.downloadAsset(&stylesheet.DownloadableAsset, s.checkCSSForUrls)
+}
+
+// mediaReferences lists the attributes of embedded media elements that
+// reference files to download.
+var mediaReferences = []struct {
+	selector  string
+	attribute string
+	kind      assetKind
+}{
+	{"video[src]", "src", assetMedia},
+	{"video[poster]", "poster", assetImage},
+	{"audio[src]", "src", assetMedia},
+	{"source[src]", "src", assetMedia},
+	{"track[src]", "src", assetPlain},
+	{"embed[src]", "src", assetMedia},
+	{"object[data]", "data", assetMedia},
+}
+
+// downloadReferences queues the assets of the page document and returns
+// them. References are resolved against the base URL.
+func (s *Scraper) downloadReferences(doc *goquery.Selection, base *url.URL) []storedAsset {
+	var assets []storedAsset
+	queue := func(refs []*url.URL, kind assetKind) {
+		for _, u := range refs {
+			s.queueReference(u, kind)
+			assets = append(assets, storedAsset{URL: u.String(), Kind: kind})
+		}
 	}
-	for _, script := range s.browser.Scripts() {
-		s.downloadAsset(&script.DownloadableAsset, nil)
+
+	queue(elementReferences(doc, base, "img[src]", "src"), assetImage)
+	queue(srcsetImages(doc, base), assetImage)
+	for _, media := range mediaReferences {
+		queue(elementReferences(doc, base, media.selector, media.attribute), media.kind)
 	}
-	for _, image := range s.imagesQueue {
-		s.downloadAsset(image, s.checkImageForRecode)
+	queue(elementReferences(doc, base, `link[rel="stylesheet"][href]`, "href"), assetStylesheet)
+	queue(elementReferences(doc, base, "script[src]", "src"), assetScript)
+	for _, ref := range s.inlineStyleReferences(doc, base) {
+		queue([]*url.URL{ref.URL}, ref.kind)
 	}
+	s.flushImagesQueue()
+	return assets
+}
+
+// inlineStyleReferences returns the assets that the style attributes and
+// style elements of the document reference.
+func (s *Scraper) inlineStyleReferences(doc *goquery.Selection, base *url.URL) []cssReference {
+	var refs []cssReference
+	doc.Find("[style]").Each(func(_ int, selection *goquery.Selection) {
+		style, _ := selection.Attr("style")
+		refs = append(refs, s.cssReferences(base, style)...)
+	})
+	doc.Find("style").Each(func(_ int, selection *goquery.Selection) {
+		refs = append(refs, s.cssReferences(base, selection.Text())...)
+	})
+	return refs
+}
+
+// srcsetImages returns the image candidates of all srcset attributes of
+// img and source elements of the document.
+func srcsetImages(doc *goquery.Selection, base *url.URL) []*url.URL {
+	var images []*url.URL
+	doc.Find("img[srcset], source[srcset]").Each(func(_ int, selection *goquery.Selection) {
+		srcset, _ := selection.Attr("srcset")
+		for _, candidate := range parseSrcset(srcset) {
+			if strings.HasPrefix(candidate.URL, "data:") {
+				continue
+			}
+			ref, err := url.Parse(candidate.URL)
+			if err != nil {
+				continue
+			}
+			images = append(images, base.ResolveReference(ref))
+		}
+	})
+	return images
+}
+
+// elementReferences returns the HTTP URLs that the given attribute of all
+// elements of the document matching the selector reference.
+func elementReferences(doc *goquery.Selection, base *url.URL, selector, attribute string) []*url.URL {
+	var refs []*url.URL
+	doc.Find(selector).Each(func(_ int, selection *goquery.Selection) {
+		value, _ := selection.Attr(attribute)
+		value = strings.TrimSpace(value)
+		if value == "" || strings.HasPrefix(value, "data:") {
+			return
+		}
+		ref, err := url.Parse(value)
+		if err != nil {
+			return
+		}
+		u := base.ResolveReference(ref)
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return
+		}
+		refs = append(refs, u)
+	})
+	return refs
+}
+
+func (s *Scraper) queueAsset(u *url.URL, kind assetKind) {
+	s.pendingAssetsMu.Lock()
+	s.pendingAssets[u.String()] = kind
+	s.pendingAssetsMu.Unlock()
+
+	s.jobs.Add(1)
+	s.assets.push(assetJob{URL: u, kind: kind})
+}
+
+// queueReference queues an asset that a page or stylesheet references,
+// images are added to the images queue.
+func (s *Scraper) queueReference(u *url.URL, kind assetKind) {
+	if kind == assetImage {
+		s.queueImage(u)
+	} else {
+		s.queueAsset(u, kind)
+	}
+}
+
+// queueImage adds an image to the images queue, images are downloaded
+// after the stylesheets and scripts of a page.
+func (s *Scraper) queueImage(u *url.URL) {
+	s.imagesQueueMu.Lock()
+	s.imagesQueue = append(s.imagesQueue, u)
+	s.imagesQueueMu.Unlock()
+}
+
+// flushImagesQueue queues all images of the images queue for downloading.
+func (s *Scraper) flushImagesQueue() {
+	s.imagesQueueMu.Lock()
+	images := s.imagesQueue
 	s.imagesQueue = nil
+	s.imagesQueueMu.Unlock()
+
+	for _, image := range images {
+		s.queueAsset(image, assetImage)
+	}
 }
 
-// downloadAsset downloads an asset if it does not exist on disk yet.
-func (s *Scraper) downloadAsset(asset *browser.DownloadableAsset, processor assetProcessor) {
-	URL := asset.URL
+func (s *Scraper) assetWorker(ctx context.Context) {
+	for {
+		job, ok := s.assets.pop()
+		if !ok {
+			return
+		}
+		asset := job.(assetJob)
+		if ctx.Err() != nil {
+			// keep the asset for the checkpoint to resume the scrape
+			s.addFailedAsset(asset.URL.String(), asset.kind, ctx.Err())
+		} else {
+			s.downloadAsset(ctx, asset.URL, asset.kind)
+		}
+		// processors like the CSS processor can find new images
+		s.flushImagesQueue()
+
+		s.pendingAssetsMu.Lock()
+		delete(s.pendingAssets, asset.URL.String())
+		s.pendingAssetsMu.Unlock()
+		s.jobs.Done()
+	}
+}
+
+// downloadAsset downloads an asset if it does not exist on disk yet or if it
+// was modified since it was downloaded.
+func (s *Scraper) downloadAsset(ctx context.Context, URL *url.URL, kind assetKind) {
 	u := URL.String()
-	if _, ok := s.processed[u]; ok {
+	if !s.processed.add(u) {
 		return // was already processed
 	}
-	s.processed[u] = struct{}{}
 
 	if s.includes != nil && !s.isURLIncluded(URL) {
+		s.onSkip(URL, SkipExcluded)
 		return
 	}
 	if s.excludes != nil && s.isURLExcluded(URL) {
+		s.onSkip(URL, SkipExcluded)
+		return
+	}
+	allowed, err := s.isAllowedByRobots(ctx, URL)
+	if err != nil {
+		// keep the asset for the checkpoint to resume the scrape
+		s.addFailedAsset(u, kind, err)
+		return
+	}
+	if !allowed {
+		s.log.Debug("Skipping asset disallowed by robots.txt", zap.String("URL", u))
+		s.onSkip(URL, SkipRobots)
 		return
 	}
 
-	filePath := s.GetFilePath(URL, false)
-	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
-		return // exists already on disk
+	filePath := s.storageName(URL, false)
+	var cached *validator
+	if s.fileExists(filePath) {
+		// files without validators can not be checked for modifications
+		if cached = s.validators.get(u); cached == nil {
+			s.onSkip(URL, SkipExists)
+			return
+		}
 	}
 
 	s.log.Info("Downloading", zap.String("URL", u))
 
-	buf := &bytes.Buffer{}
-	_, err := asset.Download(buf)
+	var resp *Response
+	err = s.retry(ctx, URL, func() error {
+		var err error
+		resp, err = s.fetch(ctx, URL, cached, s.assetSizeLimit(kind))
+		return err
+	})
+	if isNotModified(err) {
+		s.log.Debug("Asset was not modified", zap.String("URL", u))
+		// the references of a stylesheet could have been modified
+		s.queueStoredAssets(cached.Assets)
+		s.onSkip(URL, SkipNotModified)
+		return
+	}
+	if errors.Is(err, ErrBodyTooLarge) {
+		s.log.Info("Skipping asset larger than the size limit",
+			zap.String("URL", u),
+			zap.Int64("limit", s.config.MaxMediaSize))
+		s.onSkip(URL, SkipTooLarge)
+		return
+	}
+	if errors.Is(err, errRequestSkipped) {
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		s.addFailedAsset(u, kind, ctx.Err())
+		return
+	}
 	if err != nil {
 		s.log.Error("Downloading asset failed",
 			zap.String("URL", u),
 			zap.Error(err))
+		s.recordError(URL, err)
+		s.addFailedAsset(u, kind, err)
 		return
 	}
 
-	if processor != nil {
-		buf = processor(URL, buf)
+	buf, err := s.process(kind.contentType(), URL, bytes.NewBuffer(resp.Body))
+	if err != nil {
+		s.log.Error("Processing asset failed",
+			zap.String("URL", u),
+			zap.Error(err))
+		s.recordError(URL, err)
+		return
 	}
 
-	if err = s.writeFile(filePath, buf); err != nil {
+	if err = s.writeAsset(filePath, buf); err != nil {
 		s.log.Error("Writing asset file failed",
 			zap.String("URL", u),
 			zap.String("file", filePath),
 			zap.Error(err))
+		s.recordError(URL, err)
+		return
+	}
+
+	v := newValidator(resp.Header)
+	if v != nil && kind == assetStylesheet {
+		for _, ref := range s.cssReferences(URL, string(resp.Body)) {
+			v.Assets = append(v.Assets, storedAsset{URL: ref.URL.String(), Kind: ref.kind})
+		}
+	}
+	s.validators.set(u, v)
+	s.onAssetStored(URL, filePath)
+}
+
+// assetSizeLimit returns the max size in bytes of an asset of the given
+// kind, 0 for unlimited.
+func (s *Scraper) assetSizeLimit(kind assetKind) int64 {
+	if kind == assetMedia {
+		return s.config.MaxMediaSize
+	}
+	return 0
+}
+
+// fetch requests the URL using the fetcher and returns an error if the
+// request failed or returned an unexpected status code, the response is
+// returned for status code errors as well. If validators of a previous
+// download are passed a conditional request is sent. Responses with a body
+// that is larger than maxSize bytes fail, 0 disables the limit.
+func (s *Scraper) fetch(ctx context.Context, u *url.URL, cached *validator, maxSize int64) (*Response, error) {
+	req := &Request{
+		URL:     u,
+		Header:  s.requestHeaders(u),
+		MaxSize: maxSize,
+	}
+	if cached != nil {
+		cached.setConditionalHeaders(req.Header)
+	}
+	return s.send(ctx, req, true)
+}
+
+// fetchRobots requests a robots.txt file like fetch. The request is not
+// delayed by the crawl delay, which is only known after the download.
+func (s *Scraper) fetchRobots(ctx context.Context, u *url.URL) (*Response, error) {
+	req := &Request{
+		URL:    u,
+		Header: s.requestHeaders(u),
+	}
+	return s.send(ctx, req, false)
+}
+
+// send passes the request to the request hook and sends it using the
+// fetcher once the rate limits and optionally the crawl delay allow it.
+func (s *Scraper) send(ctx context.Context, req *Request, crawlDelay bool) (*Response, error) {
+	u := req.URL
+	if !s.onRequest(req) {
+		s.onSkip(u, SkipRequestHook)
+		return nil, errRequestSkipped
+	}
+
+	release, err := s.waitForRequest(ctx, u, crawlDelay)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.fetcher.Fetch(ctx, req)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	s.onResponse(resp)
+
+	// the WARC file archives all exchanges, including the followed
+	// redirects and responses with unexpected status codes
+	for _, redirect := range resp.Redirects {
+		s.writeWARC(redirect.URL, sentHeader(req, redirect.RequestHeader), redirect.StatusCode, redirect.Header, nil)
+	}
+	s.writeWARC(resp.URL, sentHeader(req, resp.RequestHeader), resp.StatusCode, resp.Header, resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, newStatusError(resp.StatusCode, resp.Header)
+	}
+	return resp, nil
+}
+
+// sentHeader returns the headers that the fetcher reported as sent, or the
+// headers of the request if it did not report them.
+func sentHeader(req *Request, sent http.Header) http.Header {
+	if sent == nil {
+		return req.Header
+	}
+	return sent
+}
+
+// writeWARC writes a request of the URL with the given headers and its
+// response to the WARC file if WARC output is enabled.
+func (s *Scraper) writeWARC(u *url.URL, reqHeader http.Header, statusCode int, header http.Header, body []byte) {
+	if s.warc == nil {
+		return
+	}
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Header: reqHeader,
+	}
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode: statusCode,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+	}
+	if err := s.warc.writeExchange(req, resp, body); err != nil {
+		s.log.Error("Writing WARC record failed",
+			zap.Stringer("URL", u),
+			zap.Error(err))
 	}
 }
@@ -0,0 +1,173 @@
+package scraper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/headzoo/surf"
+	"github.com/headzoo/surf/browser"
+	"github.com/headzoo/surf/jar"
+)
+
+// ErrBodyTooLarge is returned by fetchers for responses with a body that is
+// larger than the max size of the request.
+var ErrBodyTooLarge = errors.New("response body is larger than the size limit")
+
+// Request is a GET request of a URL that a Fetcher sends.
+type Request struct {
+	URL     *url.URL
+	Header  http.Header // headers to send, including the user agent
+	MaxSize int64       // max size in bytes of the response body, 0 for unlimited
+}
+
+// Redirect is a redirect response that a Fetcher followed.
+type Redirect struct {
+	URL           *url.URL    // URL of the request that got redirected
+	RequestHeader http.Header // headers of the request as sent, nil if unknown
+	StatusCode    int
+	Header        http.Header
+}
+
+// Response is the response that a Fetcher returns for a request.
+type Response struct {
+	URL           *url.URL    // final URL of the response after all redirects
+	RequestHeader http.Header // headers of the final request as sent, nil if unknown
+	StatusCode    int
+	Header        http.Header
+	Body          []byte     // decoded content of the response
+	Redirects     []Redirect // followed redirects in the order of the requests
+}
+
+// Fetcher downloads the content of URLs. It has to follow redirects and
+// return responses with any status code without an error. Requests should
+// be aborted once the context gets cancelled. Fetch is called concurrently
+// by the page and asset workers.
+type Fetcher interface {
+	Fetch(ctx context.Context, req *Request) (*Response, error)
+}
+
+// surfFetcher is the default fetcher, it opens every request in a new surf
+// browser as a browser keeps the state of the last opened page. All
+// browsers share the same cookies.
+type surfFetcher struct {
+	cookies http.CookieJar
+	timeout time.Duration
+}
+
+func newSurfFetcher(timeout time.Duration) *surfFetcher {
+	return &surfFetcher{
+		cookies: jar.NewMemoryCookies(),
+		timeout: timeout,
+	}
+}
+
+// Fetch implements the Fetcher interface.
+func (f *surfFetcher) Fetch(ctx context.Context, req *Request) (*Response, error) {
+	b := surf.NewBrowser()
+	b.SetUserAgent(req.Header.Get("User-Agent"))
+	b.SetHeadersJar(req.Header.Clone())
+	b.SetTimeout(f.timeout)
+	b.SetCookieJar(f.cookies)
+	b.SetTransport(&surfTransport{ctx: ctx, maxSize: req.MaxSize})
+	// meta refresh handling reloads the page in the background
+	b.SetAttribute(browser.MetaRefreshHandling, false)
+
+	if err := b.Open(req.URL.String()); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if _, err := b.Download(buf); err != nil {
+		return nil, err
+	}
+	resp := b.State().Response
+	return &Response{
+		URL:           b.Url(),
+		RequestHeader: resp.Request.Header,
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		Body:          buf.Bytes(),
+		Redirects:     redirectsOf(resp),
+	}, nil
+}
+
+// redirectsOf returns the redirect responses that led to the given
+// response, in the order they were received.
+func redirectsOf(resp *http.Response) []Redirect {
+	var redirects []Redirect
+	for req := resp.Request; req != nil && req.Response != nil; req = req.Response.Request {
+		redirect := Redirect{
+			URL:           req.Response.Request.URL,
+			RequestHeader: req.Response.Request.Header,
+			StatusCode:    req.Response.StatusCode,
+			Header:        req.Response.Header,
+		}
+		redirects = append([]Redirect{redirect}, redirects...)
+	}
+	return redirects
+}
+
+// surfTransport is a HTTP transport that sends the requests of a surf
+// browser with the context of the fetch, as surf does not support contexts.
+// It fails responses with a body that is larger than the max size, 0
+// disables the limit. The request of a response contains the headers that
+// were sent.
+type surfTransport struct {
+	ctx     context.Context
+	maxSize int64
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *surfTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req.WithContext(t.ctx))
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = sentRequest(req)
+	if t.maxSize <= 0 {
+		return resp, nil
+	}
+	if resp.ContentLength > t.maxSize {
+		_ = resp.Body.Close()
+		return nil, ErrBodyTooLarge
+	}
+	resp.Body = &limitedBody{
+		ReadCloser: resp.Body,
+		remaining:  t.maxSize,
+	}
+	return resp, nil
+}
+
+// sentRequest returns a copy of the request with the headers that the
+// default transport sends. It requests a gzip encoding itself if the request
+// does not ask for an encoding or range and decodes the response
+// transparently in that case.
+func sentRequest(req *http.Request) *http.Request {
+	sent := req.Clone(req.Context())
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" &&
+		req.Method != http.MethodHead {
+		sent.Header.Set("Accept-Encoding", "gzip")
+	}
+	return sent
+}
+
+// limitedBody is a response body that returns ErrBodyTooLarge once more
+// than the remaining bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrBodyTooLarge
+	}
+	return n, err
+}
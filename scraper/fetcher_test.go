@@ -0,0 +1,107 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// replayFetcher is an in-memory fetcher that returns the stored content by
+// URL and records the requested URLs.
+type replayFetcher struct {
+	mu        sync.Mutex
+	content   map[string]string
+	requested []string
+}
+
+func (f *replayFetcher) Fetch(_ context.Context, req *Request) (*Response, error) {
+	f.mu.Lock()
+	f.requested = append(f.requested, req.URL.String())
+	f.mu.Unlock()
+
+	resp := &Response{
+		URL:    req.URL,
+		Header: make(http.Header),
+	}
+	body, ok := f.content[req.URL.String()]
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		return resp, nil
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Body = []byte(body)
+	if strings.HasSuffix(req.URL.Path, "/") {
+		resp.Header.Set("Content-Type", "text/html")
+	}
+	return resp, nil
+}
+
+func TestScrapeCustomFetcher(t *testing.T) {
+	fetcher := &replayFetcher{
+		content: map[string]string{
+			"http://replay.invalid/":        `<html><body><a href="a/">a</a><img src="x.png"></body></html>`,
+			"http://replay.invalid/a/":      `<html><body><script src="/app.js"></script></body></html>`,
+			"http://replay.invalid/x.png":   "image",
+			"http://replay.invalid/app.js":  "script",
+			"http://replay.invalid/unused/": "unused",
+		},
+	}
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		Fetcher: fetcher,
+	}
+	dir := scrapeTestURL(t, "http://replay.invalid/", cfg, output)
+
+	assertStored(t, dir, "index.html", "a/index.html", "x.png", "app.js")
+	assertNotStored(t, dir, "unused")
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "app.js"))
+	if err != nil {
+		t.Fatalf("Reading asset failed: %v", err)
+	}
+	if string(data) != "script" {
+		t.Errorf("Asset content should be %q but was %q", "script", data)
+	}
+	// robots.txt is requested using the fetcher as well
+	if len(fetcher.requested) != 5 || fetcher.requested[0] != "http://replay.invalid/robots.txt" {
+		t.Errorf("Expected 5 requests starting with robots.txt but got %d: %v", len(fetcher.requested), fetcher.requested)
+	}
+}
+
+func TestSurfFetcherSizeLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		// flushing prevents a content length header
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+		w.(http.Flusher).Flush()
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/file")
+	fetcher := newSurfFetcher(0)
+
+	resp, err := fetcher.Fetch(context.Background(), &Request{URL: u, Header: make(http.Header), MaxSize: 200})
+	if err != nil {
+		t.Fatalf("Fetching within the size limit failed: %v", err)
+	}
+	if len(resp.Body) != 200 {
+		t.Errorf("Body should have 200 bytes but had %d", len(resp.Body))
+	}
+
+	_, err = fetcher.Fetch(context.Background(), &Request{URL: u, Header: make(http.Header), MaxSize: 150})
+	if !errors.Is(err, ErrBodyTooLarge) {
+		t.Errorf("Fetching above the size limit should fail with ErrBodyTooLarge but got %v", err)
+	}
+}
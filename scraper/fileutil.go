@@ -3,7 +3,7 @@ package scraper
 import (
 	"bytes"
 	"net/url"
-	"os"
+	"path"
 	"path/filepath"
 
 	"go.uber.org/zap"
@@ -41,41 +41,51 @@ func GetPageFilePath(url *url.URL) string {
 
 // GetFilePath returns a file path for a URL to store the URL content in
 func (s *Scraper) GetFilePath(url *url.URL, isAPage bool) string {
+	return filepath.Join(s.config.OutputDirectory, filepath.FromSlash(s.storageName(url, isAPage)))
+}
+
+// storageName returns the name of the file in the storage that the content
+// of the URL gets stored in.
+func (s *Scraper) storageName(url *url.URL, isAPage bool) string {
 	fileName := url.Path
 	if isAPage {
 		fileName = GetPageFilePath(url)
 	}
 
+	if suffix := s.querySuffix(url); suffix != "" {
+		fileName = addFileSuffix(fileName, suffix)
+	}
+
 	var externalHost string
 	if url.Host != s.URL.Host {
 		externalHost = "_" + url.Host // _ is a prefix for external domains on the filesystem
 	}
 
-	return filepath.Join(s.config.OutputDirectory, s.URL.Host, externalHost, fileName)
+	// the sanitized path can not leave the directory of the host
+	local := s.paths.localPath(path.Join(externalHost, sanitizePath(fileName)))
+	return path.Join(s.hostDirectory(), local)
 }
 
-func (s *Scraper) writeFile(filePath string, buf *bytes.Buffer) error {
-	dir := filepath.Dir(filePath)
-	if len(dir) < len(s.URL.Host) { // nothing to append if it is the root dir
-		dir = filepath.Join(".", s.URL.Host, dir)
-	}
-	s.log.Debug("Creating dir", zap.String("Path", dir))
-	err := os.MkdirAll(dir, os.ModePerm)
-	if err != nil {
-		return err
-	}
+// hostDirectory returns the directory in the storage that the files of the
+// scraped website get stored in. The host can contain a port separator,
+// which is illegal in file names on Windows.
+func (s *Scraper) hostDirectory() string {
+	return sanitizeSegment(s.URL.Host)
+}
 
-	s.log.Debug("Creating file", zap.String("Path", filePath))
-	f, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
+func (s *Scraper) writeFile(name string, buf *bytes.Buffer) error {
+	s.log.Debug("Creating file", zap.String("Path", name))
+	return s.storage.Write(name, buf.Bytes())
+}
 
-	if _, err = f.Write(buf.Bytes()); err != nil {
-		_ = f.Close() // try to close and remove file but return the first error
-		_ = os.Remove(filePath)
-		return err
+// fileExists returns whether a file exists in the storage, errors are
+// logged and treated as a missing file.
+func (s *Scraper) fileExists(name string) bool {
+	exists, err := s.storage.Exists(name)
+	if err != nil {
+		s.log.Error("Checking file existence failed",
+			zap.String("file", name),
+			zap.Error(err))
 	}
-
-	return f.Close()
+	return exists
 }
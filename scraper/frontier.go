@@ -0,0 +1,246 @@
+package scraper
+
+import (
+	"container/heap"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// FrontierMode defines the order in which discovered pages get downloaded.
+type FrontierMode string
+
+const (
+	// FrontierBFS downloads pages breadth first in the order of discovery.
+	FrontierBFS FrontierMode = "bfs"
+	// FrontierPriority downloads the pages with the lowest depth first,
+	// pages of the same depth are ordered by the number of path segments.
+	FrontierPriority FrontierMode = "priority"
+)
+
+// frontierItem is a page that is queued in the frontier.
+type frontierItem struct {
+	key      string
+	URL      *url.URL
+	depth    uint
+	segments int    // number of path segments, used by the priority mode
+	seq      uint64 // discovery order
+	index    int    // index in the heap
+}
+
+// frontier is the queue of pages to download. It records the minimum depth
+// at which every page was discovered, a page that is discovered again at a
+// lower depth gets its depth updated or is queued again if it was already
+// downloaded, so that the max depth limit does not depend on the order in
+// which pages are discovered.
+// It is safe for concurrent use.
+type frontier struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  frontierHeap
+	depths map[string]uint          // minimum depth by page key
+	queued map[string]*frontierItem // queued pages by page key
+	active map[uint64]*frontierItem // pages that are being downloaded by seq
+	seq    uint64
+	closed bool
+}
+
+func newFrontier(mode FrontierMode) *frontier {
+	f := &frontier{
+		items: frontierHeap{
+			priority: mode == FrontierPriority,
+		},
+		depths: make(map[string]uint),
+		queued: make(map[string]*frontierItem),
+		active: make(map[uint64]*frontierItem),
+	}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// push adds a page to the frontier and returns whether a new item was
+// queued. It returns false if the page was already discovered at the same
+// or a lower depth or if it is queued already.
+func (f *frontier) push(key string, u *url.URL, depth uint) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if d, ok := f.depths[key]; ok && depth >= d {
+		return false
+	}
+	f.depths[key] = depth
+
+	if item, ok := f.queued[key]; ok {
+		item.depth = depth
+		heap.Fix(&f.items, item.index)
+		return false
+	}
+
+	f.queue(key, u, depth)
+	return true
+}
+
+// restore queues a page of a checkpoint and returns whether a new item was
+// queued. The minimum depths of the checkpoint have to be restored first.
+func (f *frontier) restore(key string, u *url.URL, depth uint) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.queued[key]; ok {
+		return false
+	}
+	f.queue(key, u, depth)
+	return true
+}
+
+// restoreDepths sets the minimum depths of all discovered pages.
+func (f *frontier) restoreDepths(depths map[string]uint) {
+	f.mu.Lock()
+	for key, depth := range depths {
+		f.depths[key] = depth
+	}
+	f.mu.Unlock()
+}
+
+// queue adds a new item to the heap, the caller has to hold the lock.
+func (f *frontier) queue(key string, u *url.URL, depth uint) {
+	item := &frontierItem{
+		key:      key,
+		URL:      u,
+		depth:    depth,
+		segments: strings.Count(strings.Trim(u.Path, "/"), "/"),
+		seq:      f.seq,
+	}
+	f.seq++
+	f.queued[key] = item
+	heap.Push(&f.items, item)
+	f.cond.Signal()
+}
+
+// discovered returns whether the page was already discovered at the same or
+// a lower depth.
+func (f *frontier) discovered(key string, depth uint) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d, ok := f.depths[key]
+	return ok && depth >= d
+}
+
+// markDiscovered marks the page as discovered at the given depth without
+// queueing it, which is used for pages that were downloaded through a
+// redirect.
+func (f *frontier) markDiscovered(key string, depth uint) {
+	f.mu.Lock()
+	if d, ok := f.depths[key]; !ok || depth < d {
+		f.depths[key] = depth
+	}
+	f.mu.Unlock()
+}
+
+// reject marks the page as discovered at the lowest depth so that it will
+// never be queued.
+func (f *frontier) reject(key string) {
+	f.mu.Lock()
+	f.depths[key] = 0
+	f.mu.Unlock()
+}
+
+// pop returns the next page to download, it blocks until a page is
+// available and returns false if the frontier got closed.
+func (f *frontier) pop() (pageJob, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for f.items.Len() == 0 && !f.closed {
+		f.cond.Wait()
+	}
+	if f.items.Len() == 0 {
+		return pageJob{}, false
+	}
+
+	item := heap.Pop(&f.items).(*frontierItem)
+	delete(f.queued, item.key)
+	f.active[item.seq] = item
+	return pageJob{URL: item.URL, depth: item.depth, seq: item.seq}, true
+}
+
+// done marks a page that was returned by pop as finished.
+func (f *frontier) done(job pageJob) {
+	f.mu.Lock()
+	delete(f.active, job.seq)
+	f.mu.Unlock()
+}
+
+// snapshot returns all queued and active pages and a copy of the minimum
+// depths of all discovered pages.
+func (f *frontier) snapshot() ([]pageJob, map[string]uint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pending := make([]pageJob, 0, len(f.items.items)+len(f.active))
+	for _, item := range f.active {
+		pending = append(pending, pageJob{URL: item.URL, depth: item.depth})
+	}
+	for _, item := range f.items.items {
+		pending = append(pending, pageJob{URL: item.URL, depth: item.depth})
+	}
+
+	depths := make(map[string]uint, len(f.depths))
+	for key, depth := range f.depths {
+		depths[key] = depth
+	}
+	return pending, depths
+}
+
+// close wakes up all waiting workers and makes pop return false once the
+// frontier is empty.
+func (f *frontier) close() {
+	f.mu.Lock()
+	f.closed = true
+	f.mu.Unlock()
+	f.cond.Broadcast()
+}
+
+// frontierHeap implements heap.Interface for frontier items.
+type frontierHeap struct {
+	items    []*frontierItem
+	priority bool
+}
+
+func (h frontierHeap) Len() int {
+	return len(h.items)
+}
+
+func (h frontierHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.priority {
+		if a.depth != b.depth {
+			return a.depth < b.depth
+		}
+		if a.segments != b.segments {
+			return a.segments < b.segments
+		}
+	}
+	return a.seq < b.seq
+}
+
+func (h frontierHeap) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+	h.items[i].index = i
+	h.items[j].index = j
+}
+
+func (h *frontierHeap) Push(x interface{}) {
+	item := x.(*frontierItem)
+	item.index = len(h.items)
+	h.items = append(h.items, item)
+}
+
+func (h *frontierHeap) Pop() interface{} {
+	n := len(h.items)
+	item := h.items[n-1]
+	h.items[n-1] = nil
+	h.items = h.items[:n-1]
+	return item
+}
@@ -0,0 +1,76 @@
+package scraper
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestFrontierMinimumDepth(t *testing.T) {
+	f := newFrontier(FrontierBFS)
+	u := &url.URL{Path: "/page"}
+
+	if !f.push("/page", u, 3) {
+		t.Fatal("New page was not queued")
+	}
+	if f.push("/page", u, 4) {
+		t.Error("Page discovered at a higher depth was queued again")
+	}
+	if f.push("/page", u, 1) {
+		t.Error("Queued page was queued twice")
+	}
+
+	job, ok := f.pop()
+	if !ok {
+		t.Fatal("Frontier returned no page")
+	}
+	if job.depth != 1 {
+		t.Errorf("Page should have depth 1 but had %d", job.depth)
+	}
+
+	if !f.discovered("/page", 1) {
+		t.Error("Page discovered at depth 1 was not reported as discovered")
+	}
+	if !f.push("/page", u, 0) {
+		t.Error("Downloaded page discovered at a lower depth was not queued again")
+	}
+}
+
+func TestFrontierOrder(t *testing.T) {
+	type fixture struct {
+		Path  string
+		Depth uint
+	}
+
+	pages := []fixture{
+		{"/a/b/c", 2},
+		{"/x", 2},
+		{"/a/b", 1},
+		{"/y/z", 1},
+	}
+
+	var expected = map[FrontierMode][]string{
+		FrontierBFS:      {"/a/b/c", "/x", "/a/b", "/y/z"},
+		FrontierPriority: {"/a/b", "/y/z", "/x", "/a/b/c"},
+	}
+
+	for mode, order := range expected {
+		f := newFrontier(mode)
+		for _, page := range pages {
+			f.push(page.Path, &url.URL{Path: page.Path}, page.Depth)
+		}
+		f.close()
+
+		for _, path := range order {
+			job, ok := f.pop()
+			if !ok {
+				t.Fatalf("Frontier %s returned no page", mode)
+			}
+			if job.URL.Path != path {
+				t.Errorf("Frontier %s should have returned %s but returned %s", mode, path, job.URL.Path)
+			}
+		}
+		if _, ok := f.pop(); ok {
+			t.Errorf("Closed frontier %s returned a page", mode)
+		}
+	}
+}
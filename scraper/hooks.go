@@ -0,0 +1,72 @@
+package scraper
+
+import (
+	"errors"
+	"net/url"
+)
+
+// SkipReason describes why a discovered URL was not downloaded.
+type SkipReason string
+
+const (
+	// SkipExternal is used for pages of other hosts than the scraped one.
+	SkipExternal SkipReason = "external"
+	// SkipDepth is used for pages that are deeper than the max depth.
+	SkipDepth SkipReason = "depth"
+	// SkipExcluded is used for URLs that do not match the include and
+	// exclude filters.
+	SkipExcluded SkipReason = "excluded"
+	// SkipRobots is used for URLs that are disallowed by robots.txt.
+	SkipRobots SkipReason = "robots"
+	// SkipExists is used for assets that exist already in the storage and
+	// can not be checked for modifications.
+	SkipExists SkipReason = "exists"
+	// SkipNotModified is used for URLs that were not modified since the
+	// last scrape.
+	SkipNotModified SkipReason = "not modified"
+	// SkipTooLarge is used for assets that are larger than the size limit.
+	SkipTooLarge SkipReason = "too large"
+	// SkipRequestHook is used for requests that the OnRequest hook rejected.
+	SkipRequestHook SkipReason = "request hook"
+)
+
+// errRequestSkipped is returned by fetch for requests that the OnRequest
+// hook rejected.
+var errRequestSkipped = errors.New("request skipped by hook")
+
+func (s *Scraper) onRequest(req *Request) bool {
+	if s.OnRequest == nil {
+		return true
+	}
+	return s.OnRequest(req)
+}
+
+func (s *Scraper) onResponse(resp *Response) {
+	if s.OnResponse != nil {
+		s.OnResponse(resp)
+	}
+}
+
+func (s *Scraper) onPageStored(u *url.URL, name string) {
+	if s.OnPageStored != nil {
+		s.OnPageStored(u, name)
+	}
+}
+
+func (s *Scraper) onAssetStored(u *url.URL, name string) {
+	if s.OnAssetStored != nil {
+		s.OnAssetStored(u, name)
+	}
+}
+
+func (s *Scraper) onSkip(u *url.URL, reason SkipReason) {
+	if s.OnSkip != nil {
+		s.OnSkip(u, reason)
+	}
+}
+
+func (s *Scraper) onError(u *url.URL, err error) {
+	if s.OnError != nil {
+		s.OnError(u, err)
+	}
+}
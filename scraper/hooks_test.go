@@ -0,0 +1,139 @@
+package scraper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// hookEvents records the events of all hooks of a scraper.
+type hookEvents struct {
+	mu        sync.Mutex
+	requests  []string
+	responses []string
+	pages     []string
+	assets    []string
+	skipped   map[string]SkipReason
+	errors    []string
+}
+
+func (e *hookEvents) add(events *[]string, event string) {
+	e.mu.Lock()
+	*events = append(*events, event)
+	e.mu.Unlock()
+}
+
+func (e *hookEvents) register(s *Scraper) {
+	s.OnRequest = func(req *Request) bool {
+		e.add(&e.requests, req.URL.Path)
+		req.Header.Set("X-Hook", "1")
+		return req.URL.Path != "/private"
+	}
+	s.OnResponse = func(resp *Response) {
+		e.add(&e.responses, resp.URL.Path)
+	}
+	s.OnPageStored = func(u *url.URL, name string) {
+		e.add(&e.pages, u.Path+" "+name)
+	}
+	s.OnAssetStored = func(u *url.URL, name string) {
+		e.add(&e.assets, u.Path+" "+name)
+	}
+	s.OnSkip = func(u *url.URL, reason SkipReason) {
+		e.mu.Lock()
+		e.skipped[u.String()] = reason
+		e.mu.Unlock()
+	}
+	s.OnError = func(u *url.URL, err error) {
+		e.add(&e.errors, u.Path)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	site := testSite{
+		"/": `<html><body><a href="a">a</a><a href="private">p</a><a href="skip/me">s</a>
+			<a href="http://example.org/">e</a><a href="missing">m</a><img src="x.png"></body></html>`,
+		"/a":       `<html><body><a href="a/deep">deep</a></body></html>`,
+		"/private": `<html><body>private</body></html>`,
+		"/x.png":   "image",
+	}
+	var headers sync.Map
+	server := httptest.NewServer(recordHeaders(site, &headers))
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		URL:             server.URL + "/",
+		OutputDirectory: output,
+		Excludes:        []string{"^/skip"},
+		MaxDepth:        1,
+		IgnoreRobots:    true,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	events := &hookEvents{
+		skipped: make(map[string]SkipReason),
+	}
+	events.register(s)
+	err = s.Start()
+	if err == nil || !strings.Contains(err.Error(), "/missing: unexpected HTTP status code 404") {
+		t.Errorf("Scrape error should contain the missing page but was %v", err)
+	}
+
+	sort.Strings(events.requests)
+	if expected := []string{"/", "/a", "/missing", "/private", "/x.png"}; !reflect.DeepEqual(events.requests, expected) {
+		t.Errorf("Requests should be %v but were %v", expected, events.requests)
+	}
+	sort.Strings(events.responses)
+	if expected := []string{"/", "/a", "/missing", "/x.png"}; !reflect.DeepEqual(events.responses, expected) {
+		t.Errorf("Responses should be %v but were %v", expected, events.responses)
+	}
+	if _, ok := headers.Load("/private"); ok {
+		t.Error("Request rejected by the hook was sent")
+	}
+	if v, _ := headers.Load("/a"); v != "1" {
+		t.Errorf("Header set by the request hook was not sent, got %v", v)
+	}
+
+	host := s.hostDirectory()
+	sort.Strings(events.pages)
+	if expected := []string{"/ " + host + "/index.html", "/a " + host + "/a.html"}; !reflect.DeepEqual(events.pages, expected) {
+		t.Errorf("Stored pages should be %v but were %v", expected, events.pages)
+	}
+	if expected := []string{"/x.png " + host + "/x.png"}; !reflect.DeepEqual(events.assets, expected) {
+		t.Errorf("Stored assets should be %v but were %v", expected, events.assets)
+	}
+	if expected := []string{"/missing"}; !reflect.DeepEqual(events.errors, expected) {
+		t.Errorf("Errors should be reported for %v but were for %v", expected, events.errors)
+	}
+
+	expectedSkips := map[string]SkipReason{
+		server.URL + "/private": SkipRequestHook,
+		server.URL + "/skip/me": SkipExcluded,
+		server.URL + "/a/deep":  SkipDepth,
+		"http://example.org/":   SkipExternal,
+	}
+	if !reflect.DeepEqual(events.skipped, expectedSkips) {
+		t.Errorf("Skipped URLs should be %v but were %v", expectedSkips, events.skipped)
+	}
+}
+
+// recordHeaders returns a handler that records the X-Hook request header
+// by URL path.
+func recordHeaders(site http.Handler, headers *sync.Map) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers.Store(r.URL.Path, r.Header.Get("X-Hook"))
+		site.ServeHTTP(w, r)
+	})
+}
@@ -1,6 +1,7 @@
 package scraper
 
 import (
+	"bytes"
 	"io"
 	"net/url"
 	"strings"
@@ -9,6 +10,16 @@ import (
 	"go.uber.org/zap"
 )
 
+// fixHTMLReferences is the built-in HTML processor that relinks all
+// references of a page to the local files.
+func (s *Scraper) fixHTMLReferences(url *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error) {
+	html, err := s.fixFileReferences(url, buf)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewBufferString(html), nil
+}
+
 func (s *Scraper) fixFileReferences(url *url.URL, buf io.Reader) (string, error) {
 	g, err := goquery.NewDocumentFromReader(buf)
 	if err != nil {
@@ -16,9 +27,10 @@ func (s *Scraper) fixFileReferences(url *url.URL, buf io.Reader) (string, error)
 	}
 
 	relativeToRoot := s.urlRelativeToRoot(url)
+	base := resolveBaseHref(g.Selection, url)
 
 	g.Find("a").Each(func(_ int, selection *goquery.Selection) {
-		s.fixQuerySelection(url, "href", selection, true, relativeToRoot)
+		s.fixQuerySelection(url, "href", selection, !s.isDownloadReference(url, selection), relativeToRoot)
 	})
 
 	g.Find("link").Each(func(_ int, selection *goquery.Selection) {
@@ -33,6 +45,40 @@ func (s *Scraper) fixFileReferences(url *url.URL, buf io.Reader) (string, error)
 		s.fixQuerySelection(url, "src", selection, false, relativeToRoot)
 	})
 
+	g.Find("iframe").Each(func(_ int, selection *goquery.Selection) {
+		s.fixQuerySelection(url, "src", selection, true, relativeToRoot)
+	})
+
+	for _, media := range mediaReferences {
+		g.Find(media.selector).Each(func(_ int, selection *goquery.Selection) {
+			s.fixQuerySelection(url, media.attribute, selection, false, relativeToRoot)
+		})
+	}
+
+	g.Find("img[srcset], source[srcset]").Each(func(_ int, selection *goquery.Selection) {
+		s.fixSrcsetSelection(url, selection, relativeToRoot)
+	})
+
+	metaRefreshElements(g.Selection).Each(func(_ int, selection *goquery.Selection) {
+		s.fixMetaRefreshSelection(url, selection, relativeToRoot)
+	})
+
+	g.Find("[style]").Each(func(_ int, selection *goquery.Selection) {
+		style, _ := selection.Attr("style")
+		refs := s.cssReferences(base, style)
+		if fixed := s.fixCSSReferences(url, style, refs, relativeToRoot); fixed != style {
+			selection.SetAttr("style", fixed)
+		}
+	})
+
+	g.Find("style").Each(func(_ int, selection *goquery.Selection) {
+		css := selection.Text()
+		refs := s.cssReferences(base, css)
+		if fixed := s.fixCSSReferences(url, css, refs, relativeToRoot); fixed != css {
+			selection.SetText(fixed)
+		}
+	})
+
 	return g.Html()
 }
 
@@ -49,6 +95,9 @@ func (s *Scraper) fixQuerySelection(url *url.URL, attribute string, selection *g
 	if strings.HasPrefix(src, "mailto:") {
 		return
 	}
+	if strings.HasPrefix(src, "about:") || strings.HasPrefix(src, "javascript:") {
+		return
+	}
 
 	resolved := s.resolveURL(url, src, linkIsAPage, relativeToRoot)
 	if src == resolved { // nothing changed
@@ -58,3 +107,127 @@ func (s *Scraper) fixQuerySelection(url *url.URL, attribute string, selection *g
 	s.log.Debug("HTML Element relinked", zap.String("URL", src), zap.String("Fixed", resolved))
 	selection.SetAttr(attribute, resolved)
 }
+
+// isDownloadReference returns whether the href attribute of the selection
+// references a file that is not a HTML page.
+func (s *Scraper) isDownloadReference(url *url.URL, selection *goquery.Selection) bool {
+	href, _ := selection.Attr("href")
+	u, err := url.Parse(href) // resolves the reference against the page URL
+	if err != nil {
+		return false
+	}
+	return s.isDownloadLink(u)
+}
+
+// fixMetaRefreshSelection relinks the target URL of a meta refresh element.
+func (s *Scraper) fixMetaRefreshSelection(url *url.URL, selection *goquery.Selection, relativeToRoot string) {
+	content, _ := selection.Attr("content")
+	delay, target, ok := parseMetaRefresh(content)
+	if !ok {
+		return
+	}
+
+	resolved := s.resolveURL(url, target, true, relativeToRoot)
+	if target == resolved { // nothing changed
+		return
+	}
+
+	s.log.Debug("HTML meta refresh relinked", zap.String("URL", target), zap.String("Fixed", resolved))
+	selection.SetAttr("content", delay+"; url="+resolved)
+}
+
+// fixSrcsetSelection relinks all image candidates of the srcset attribute
+// of the selection.
+func (s *Scraper) fixSrcsetSelection(url *url.URL, selection *goquery.Selection, relativeToRoot string) {
+	srcset, _ := selection.Attr("srcset")
+	candidates := parseSrcset(srcset)
+	for i, candidate := range candidates {
+		if strings.HasPrefix(candidate.URL, "data:") {
+			continue
+		}
+		candidates[i].URL = s.resolveURL(url, candidate.URL, false, relativeToRoot)
+	}
+
+	resolved := formatSrcset(candidates)
+	if srcset == resolved { // nothing changed
+		return
+	}
+
+	s.log.Debug("HTML Element srcset relinked", zap.String("srcset", srcset), zap.String("Fixed", resolved))
+	selection.SetAttr("srcset", resolved)
+}
+
+// baseReferences lists the attributes of elements that reference URLs that
+// are resolved against the base URL of a document.
+var baseReferences = []struct {
+	selector  string
+	attribute string
+}{
+	{"a[href]", "href"},
+	{"link[href]", "href"},
+	{"img[src]", "src"},
+	{"script[src]", "src"},
+	{"iframe[src]", "src"},
+}
+
+// resolveBaseHref resolves all references of the document against the URL
+// of its base element and removes the element, as the stored page links to
+// files relative to its own location. It returns the base URL that other
+// references like the ones of inline CSS have to be resolved against.
+func resolveBaseHref(doc *goquery.Selection, pageURL *url.URL) *url.URL {
+	element := doc.Find("base[href]").First()
+	if element.Length() == 0 {
+		return pageURL
+	}
+	href, _ := element.Attr("href")
+	element.Remove()
+
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return pageURL
+	}
+	base := pageURL.ResolveReference(ref)
+
+	resolve := func(reference string) string {
+		ref, err := url.Parse(strings.TrimSpace(reference))
+		if err != nil {
+			return reference
+		}
+		return base.ResolveReference(ref).String()
+	}
+	resolveAttribute := func(selector, attribute string) {
+		doc.Find(selector).Each(func(_ int, selection *goquery.Selection) {
+			value, _ := selection.Attr(attribute)
+			if !strings.HasPrefix(value, "data:") {
+				selection.SetAttr(attribute, resolve(value))
+			}
+		})
+	}
+
+	for _, reference := range baseReferences {
+		resolveAttribute(reference.selector, reference.attribute)
+	}
+	for _, media := range mediaReferences {
+		resolveAttribute(media.selector, media.attribute)
+	}
+
+	doc.Find("img[srcset], source[srcset]").Each(func(_ int, selection *goquery.Selection) {
+		srcset, _ := selection.Attr("srcset")
+		candidates := parseSrcset(srcset)
+		for i, candidate := range candidates {
+			if !strings.HasPrefix(candidate.URL, "data:") {
+				candidates[i].URL = resolve(candidate.URL)
+			}
+		}
+		selection.SetAttr("srcset", formatSrcset(candidates))
+	})
+
+	metaRefreshElements(doc).Each(func(_ int, selection *goquery.Selection) {
+		content, _ := selection.Attr("content")
+		if delay, target, ok := parseMetaRefresh(content); ok {
+			selection.SetAttr("content", delay+"; url="+resolve(target))
+		}
+	})
+
+	return base
+}
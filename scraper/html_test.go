@@ -1,6 +1,10 @@
 package scraper
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"go.uber.org/zap/zaptest"
@@ -26,3 +30,30 @@ func TestRemoveAnchor(t *testing.T) {
 		}
 	}
 }
+
+func TestScrapeBaseHref(t *testing.T) {
+	site := testSite{
+		"/": `<html><body><a href="blog/post/">post</a></body></html>`,
+		"/blog/post/": `<html><head><base href="/blog/"></head><body>
+			<a href="other/">other</a><img src="img/x.png">
+			<div style="background: url(bg.png)"></div></body></html>`,
+		"/blog/other/":    `<html><body>other</body></html>`,
+		"/blog/img/x.png": "x",
+		"/blog/bg.png":    "bg",
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, Config{}, output)
+
+	assertStored(t, dir, "blog/other/index.html", "blog/img/x.png", "blog/bg.png")
+
+	file := filepath.Join(dir, "blog", "post", "index.html")
+	assertContains(t, file, `href="../other/index.html"`, `src="../img/x.png"`, "url(../bg.png)")
+	page, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Reading page failed: %v", err)
+	}
+	if strings.Contains(string(page), "<base") {
+		t.Errorf("Page still contains the base element:\n%s", page)
+	}
+}
@@ -14,14 +14,16 @@ import (
 	"go.uber.org/zap"
 )
 
-func (s *Scraper) checkImageForRecode(url *url.URL, buf *bytes.Buffer) *bytes.Buffer {
+// checkImageForRecode is the built-in image processor that recodes JPEG and
+// PNG images with the configured quality if that makes them smaller.
+func (s *Scraper) checkImageForRecode(url *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error) {
 	if s.config.ImageQuality == 0 {
-		return buf
+		return buf, nil
 	}
 
 	kind, err := filetype.Match(buf.Bytes())
 	if err != nil || kind == types.Unknown {
-		return buf
+		return buf, nil
 	}
 
 	s.log.Debug("File type detected",
@@ -30,19 +32,19 @@ func (s *Scraper) checkImageForRecode(url *url.URL, buf *bytes.Buffer) *bytes.Bu
 
 	if kind.MIME.Type == matchers.TypeJpeg.MIME.Type && kind.MIME.Subtype == matchers.TypeJpeg.MIME.Subtype {
 		if recoded := s.recodeJPEG(url, buf.Bytes()); recoded != nil {
-			return recoded
+			return recoded, nil
 		}
-		return buf
+		return buf, nil
 	}
 
 	if kind.MIME.Type == matchers.TypePng.MIME.Type && kind.MIME.Subtype == matchers.TypePng.MIME.Subtype {
 		if recoded := s.recodePNG(url, buf.Bytes()); recoded != nil {
-			return recoded
+			return recoded, nil
 		}
-		return buf
+		return buf, nil
 	}
 
-	return buf
+	return buf, nil
 }
 
 // encodeJPEG encodes a new JPG based on the given quality setting
@@ -0,0 +1,108 @@
+package scraper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// ObjectsDirectory is the directory in the storage that contains the unique
+// asset contents if deduplication is enabled.
+const ObjectsDirectory = ".goscrape-objects"
+
+// objectLocks is the number of locks that serialize the writes of objects,
+// objects are assigned to a lock by their hash.
+const objectLocks = 64
+
+// objectStore stores every unique asset content once, named by its hash.
+// The asset files are hardlinks to the stored objects.
+// It is safe for concurrent use.
+type objectStore struct {
+	// writing an object is only serialized with writes of the same
+	// content, otherwise assets are written concurrently
+	locks [objectLocks]sync.Mutex
+
+	mu          sync.Mutex // protects the counters
+	savedBytes  int64      // size of all contents that were already stored
+	savedFiles  int64      // number of asset files that link to existing objects
+	linkedFiles int64      // number of asset files that link to objects
+}
+
+func newObjectStore() *objectStore {
+	return &objectStore{}
+}
+
+// objectName returns the file name of the object that stores the content
+// and the index of its lock.
+func objectName(content []byte) (string, int) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+	return path.Join(ObjectsDirectory, hash[:2], hash[2:]), int(sum[0]) % objectLocks
+}
+
+// storeObject writes the object unless it exists already and returns
+// whether it existed.
+func (s *Scraper) storeObject(object string, lock int, buf *bytes.Buffer) (bool, error) {
+	o := s.objects
+	o.locks[lock].Lock()
+	defer o.locks[lock].Unlock()
+
+	if s.fileExists(object) {
+		return true, nil
+	}
+	return false, s.writeFile(object, buf)
+}
+
+// writeAsset writes the content of an asset to the file. If deduplication
+// is enabled the file becomes a hardlink to the object that stores the
+// content, falling back to a copy if the file system does not support
+// hardlinks. Files are always replaced and never written through, as they
+// can be hardlinks to an object that other files share.
+func (s *Scraper) writeAsset(filePath string, buf *bytes.Buffer) error {
+	if s.objects == nil {
+		return s.writeFile(filePath, buf)
+	}
+
+	o := s.objects
+	object, lock := objectName(buf.Bytes())
+	existed, err := s.storeObject(object, lock, buf)
+	if err != nil {
+		return err
+	}
+
+	// objects are never removed, the link can be created without a lock
+	if err = s.storage.(linker).Link(object, filePath); err != nil {
+		s.log.Debug("Creating hardlink failed, copying file",
+			zap.String("file", filePath),
+			zap.Error(err))
+		return s.writeFile(filePath, buf)
+	}
+
+	o.mu.Lock()
+	if existed {
+		o.savedBytes += int64(buf.Len())
+		o.savedFiles++
+	}
+	o.linkedFiles++
+	o.mu.Unlock()
+	return nil
+}
+
+// logDeduplication logs how much disk space the deduplication saved.
+func (s *Scraper) logDeduplication() {
+	o := s.objects
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s.log.Info("Deduplicated assets",
+		zap.Int64("linked_files", o.linkedFiles),
+		zap.Int64("duplicate_files", o.savedFiles),
+		zap.Int64("bytes_saved", o.savedBytes))
+}
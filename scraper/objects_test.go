@@ -0,0 +1,129 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestScrapeDeduplicate(t *testing.T) {
+	site := testSite{
+		"/":          `<html><body><img src="a.png"><img src="b.png?v=2"><img src="other.png"></body></html>`,
+		"/a.png":     "same image",
+		"/b.png":     "same image",
+		"/other.png": "other image",
+	}
+	cfg := Config{
+		Deduplicate: true,
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, cfg, output)
+
+	assertStored(t, dir, "a.png", "other.png")
+	files, err := filepath.Glob(filepath.Join(dir, "b_*.png"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one stored file for b.png but got %v: %v", files, err)
+	}
+	a, err := os.Stat(filepath.Join(dir, "a.png"))
+	if err != nil {
+		t.Fatalf("File a.png was not stored: %v", err)
+	}
+	b, err := os.Stat(files[0])
+	if err != nil {
+		t.Fatalf("File %s was not stored: %v", files[0], err)
+	}
+	if !os.SameFile(a, b) {
+		t.Error("Files with the same content are not hardlinked")
+	}
+
+	var objects int
+	err = filepath.Walk(filepath.Join(output, ObjectsDirectory), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			objects++
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Walking objects directory failed: %v", err)
+	}
+	if objects != 2 {
+		t.Errorf("Expected 2 stored objects but got %d", objects)
+	}
+}
+
+func TestWriteAssetReplacesLink(t *testing.T) {
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		URL:             "http://localhost",
+		OutputDirectory: output,
+		Deduplicate:     true,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	for _, file := range []string{"a.txt", "b.txt"} {
+		if err = s.writeAsset(file, bytes.NewBufferString("shared")); err != nil {
+			t.Fatalf("Writing asset failed: %v", err)
+		}
+	}
+	if s.objects.savedBytes != int64(len("shared")) || s.objects.savedFiles != 1 {
+		t.Errorf("Unexpected deduplication result of %d bytes in %d files", s.objects.savedBytes, s.objects.savedFiles)
+	}
+
+	if err = s.writeAsset("a.txt", bytes.NewBufferString("changed")); err != nil {
+		t.Fatalf("Writing asset failed: %v", err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(output, "b.txt"))
+	if err != nil {
+		t.Fatalf("Reading asset failed: %v", err)
+	}
+	if string(data) != "shared" {
+		t.Errorf("Updating a linked asset changed the content of another asset to %q", data)
+	}
+}
+
+func TestWriteAssetConcurrent(t *testing.T) {
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		URL:             "http://localhost",
+		OutputDirectory: output,
+		Deduplicate:     true,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	const files = 20
+	var wg sync.WaitGroup
+	for i := 0; i < files; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			content := fmt.Sprintf("content %d", i%2)
+			if err := s.writeAsset(fmt.Sprintf("%d.txt", i), bytes.NewBufferString(content)); err != nil {
+				t.Errorf("Writing asset failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// every content is stored once, the other files are duplicates
+	if s.objects.linkedFiles != files || s.objects.savedFiles != files-2 {
+		t.Errorf("Expected %d linked files and %d duplicates but got %d and %d",
+			files, files-2, s.objects.linkedFiles, s.objects.savedFiles)
+	}
+}
@@ -0,0 +1,88 @@
+package scraper
+
+import (
+	"bytes"
+	"net/url"
+	"sync"
+)
+
+// ContentType is the type of downloaded content that processors are
+// registered for.
+type ContentType string
+
+const (
+	// ContentHTML is the content of pages.
+	ContentHTML ContentType = "html"
+	// ContentCSS is the content of stylesheets.
+	ContentCSS ContentType = "css"
+	// ContentJS is the content of scripts.
+	ContentJS ContentType = "js"
+	// ContentImage is the content of images.
+	ContentImage ContentType = "image"
+	// ContentOther is the content of all other assets and linked downloads.
+	ContentOther ContentType = "other"
+)
+
+// Processor transforms the downloaded content of a URL before it gets
+// stored and returns the new content, which can be the passed buffer.
+// Returning an error skips storing the content.
+type Processor func(u *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error)
+
+// ProcessorRegistry contains the processors of every content type in the
+// order in which they run.
+// It is safe for concurrent use.
+type ProcessorRegistry struct {
+	mu         sync.RWMutex
+	processors map[ContentType][]Processor
+}
+
+// NewProcessorRegistry returns an empty processor registry.
+func NewProcessorRegistry() *ProcessorRegistry {
+	return &ProcessorRegistry{
+		processors: make(map[ContentType][]Processor),
+	}
+}
+
+// Register adds a processor that runs after all processors that are
+// already registered for the content type.
+func (r *ProcessorRegistry) Register(contentType ContentType, processor Processor) {
+	r.mu.Lock()
+	r.processors[contentType] = append(r.processors[contentType], processor)
+	r.mu.Unlock()
+}
+
+// Set replaces all processors of the content type, including the built-in
+// ones. Removing the built-in processors of HTML and CSS content leaves
+// the references of the stored files pointing to the website.
+func (r *ProcessorRegistry) Set(contentType ContentType, processors ...Processor) {
+	r.mu.Lock()
+	r.processors[contentType] = append([]Processor(nil), processors...)
+	r.mu.Unlock()
+}
+
+// Processors returns the processors of the content type in order.
+func (r *ProcessorRegistry) Processors(contentType ContentType) []Processor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Processor(nil), r.processors[contentType]...)
+}
+
+// registerProcessors creates the processor registry of the scraper with
+// the built-in processors.
+func (s *Scraper) registerProcessors() {
+	s.Processors = NewProcessorRegistry()
+	s.Processors.Register(ContentHTML, s.fixHTMLReferences)
+	s.Processors.Register(ContentCSS, s.checkCSSForUrls)
+	s.Processors.Register(ContentImage, s.checkImageForRecode)
+}
+
+// process runs all processors of the content type on the content.
+func (s *Scraper) process(contentType ContentType, u *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error) {
+	for _, processor := range s.Processors.Processors(contentType) {
+		var err error
+		if buf, err = processor(u, buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
@@ -0,0 +1,109 @@
+package scraper
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// replaceProcessor returns a processor that replaces all occurrences of
+// old in the content with new.
+func replaceProcessor(old, new string) Processor {
+	return func(_ *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error) {
+		return bytes.NewBufferString(strings.Replace(buf.String(), old, new, -1)), nil
+	}
+}
+
+func TestProcessorRegistry(t *testing.T) {
+	r := NewProcessorRegistry()
+	r.Register(ContentJS, replaceProcessor("a", "b"))
+	r.Register(ContentJS, replaceProcessor("b", "c"))
+
+	s := &Scraper{Processors: r}
+	buf, err := s.process(ContentJS, nil, bytes.NewBufferString("a"))
+	if err != nil {
+		t.Fatalf("Processing failed: %v", err)
+	}
+	if buf.String() != "c" {
+		t.Errorf("Processors should run in registration order, content was %q", buf.String())
+	}
+
+	r.Set(ContentJS)
+	if buf, _ = s.process(ContentJS, nil, bytes.NewBufferString("a")); buf.String() != "a" {
+		t.Errorf("Processors were not removed, content was %q", buf.String())
+	}
+	if buf, _ = s.process(ContentCSS, nil, bytes.NewBufferString("a")); buf.String() != "a" {
+		t.Errorf("Content without processors was changed to %q", buf.String())
+	}
+}
+
+func TestScrapeProcessors(t *testing.T) {
+	site := testSite{
+		"/": `<html><head><link rel="stylesheet" href="/css/main.css"><script src="/app.js"></script></head>
+			<body>SECRET<img src="/img/a.png"><a href="/data.txt">data</a><a href="/fail.txt">fail</a></body></html>`,
+		"/css/main.css": `body { background: url("/img/bg.png"); }`,
+		"/app.js":       "var a  =  1;",
+		"/img/a.png":    testPNG,
+		"/img/bg.png":   testPNG,
+		"/data.txt":     "data",
+		"/fail.txt":     "fail",
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		URL:             server.URL + "/",
+		OutputDirectory: output,
+		IgnoreRobots:    true,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	// custom processors run after the built-in relinking processors
+	s.Processors.Register(ContentHTML, replaceProcessor("SECRET", "[redacted]"))
+	s.Processors.Register(ContentCSS, replaceProcessor("../img/bg.png", "../img/bg.png?processed"))
+	s.Processors.Register(ContentJS, replaceProcessor("  ", " "))
+	s.Processors.Register(ContentImage, func(_ *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error) {
+		buf.WriteString("watermark")
+		return buf, nil
+	})
+	errFail := errors.New("processing failed")
+	s.Processors.Register(ContentOther, func(u *url.URL, buf *bytes.Buffer) (*bytes.Buffer, error) {
+		if u.Path == "/fail.txt" {
+			return nil, errFail
+		}
+		return buf, nil
+	})
+
+	err = s.Start()
+	if err == nil || !strings.Contains(err.Error(), "/fail.txt: "+errFail.Error()) {
+		t.Errorf("Scrape error should contain the processor error but was %v", err)
+	}
+
+	dir := filepath.Join(output, s.hostDirectory())
+	var expected = map[string]string{
+		"index.html":   "[redacted]",
+		"css/main.css": "url(../img/bg.png?processed)",
+		"app.js":       "var a = 1;",
+		"img/a.png":    "watermark",
+		"img/bg.png":   "watermark",
+		"data.txt":     "data",
+	}
+	for file, content := range expected {
+		assertContains(t, filepath.Join(dir, file), content)
+	}
+	// the content of a failed processor is not stored
+	assertNotStored(t, dir, "fail.txt")
+}
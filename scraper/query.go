@@ -0,0 +1,68 @@
+package scraper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net/url"
+	"path"
+)
+
+// QueryMode defines how the query strings of URLs are handled.
+type QueryMode string
+
+const (
+	// QueryKeep handles URLs with different query parameters as different
+	// pages and files, parameters that match the DropQueryParams patterns
+	// are ignored.
+	QueryKeep QueryMode = "keep"
+	// QueryDrop ignores the query strings of URLs.
+	QueryDrop QueryMode = "drop"
+)
+
+// querySuffixLength is the number of hex characters of the query hash that
+// get appended to file names.
+const querySuffixLength = 8
+
+// isQueryParamDropped returns whether the query parameter should be ignored.
+func (s *Scraper) isQueryParamDropped(name string) bool {
+	for _, pattern := range s.config.DropQueryParams {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalQuery returns the significant part of the query string of the
+// URL, with the ignored parameters removed and the remaining parameters
+// sorted by name.
+func (s *Scraper) canonicalQuery(u *url.URL) string {
+	if s.config.Query == QueryDrop || u.RawQuery == "" {
+		return ""
+	}
+
+	values, _ := url.ParseQuery(u.RawQuery)
+	for name := range values {
+		if s.isQueryParamDropped(name) {
+			delete(values, name)
+		}
+	}
+	return values.Encode()
+}
+
+// querySuffix returns the suffix to append to the file name of the URL to
+// distinguish URLs with different significant query parameters.
+func (s *Scraper) querySuffix(u *url.URL) string {
+	query := s.canonicalQuery(u)
+	if query == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(query))
+	return "_" + hex.EncodeToString(sum[:])[:querySuffixLength]
+}
+
+// addFileSuffix inserts the suffix into the file name before its extension.
+func addFileSuffix(fileName, suffix string) string {
+	ext := path.Ext(fileName)
+	return fileName[:len(fileName)-len(ext)] + suffix + ext
+}
@@ -0,0 +1,121 @@
+package scraper
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestCanonicalQuery(t *testing.T) {
+	cfg := Config{
+		URL:             "http://localhost",
+		DropQueryParams: []string{"utm_*", "sid"},
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	var fixtures = map[string]string{
+		"http://localhost/list":                            "",
+		"http://localhost/list?page=2":                     "page=2",
+		"http://localhost/list?sort=asc&page=2":            "page=2&sort=asc",
+		"http://localhost/list?page=2&utm_source=x&sid=42": "page=2",
+		"http://localhost/list?utm_medium=y":               "",
+	}
+
+	for input, expected := range fixtures {
+		u, _ := url.Parse(input)
+		if query := s.canonicalQuery(u); query != expected {
+			t.Errorf("URL %s should have canonical query %s but was %s", input, expected, query)
+		}
+	}
+
+	s.config.Query = QueryDrop
+	u, _ := url.Parse("http://localhost/list?page=2")
+	if query := s.canonicalQuery(u); query != "" {
+		t.Errorf("Query should have been dropped but was %s", query)
+	}
+}
+
+func TestGetFilePathQuery(t *testing.T) {
+	s, err := New(zaptest.NewLogger(t), Config{URL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	u1, _ := url.Parse("http://localhost/list?page=2&sort=asc")
+	u2, _ := url.Parse("http://localhost/list?sort=asc&page=2")
+	u3, _ := url.Parse("http://localhost/list?page=3&sort=asc")
+
+	p1 := s.GetFilePath(u1, true)
+	if !strings.HasPrefix(p1, "localhost/list_") || !strings.HasSuffix(p1, PageExtension) {
+		t.Errorf("Unexpected file path %s", p1)
+	}
+	if p2 := s.GetFilePath(u2, true); p1 != p2 {
+		t.Errorf("Parameter order should not change the file path, %s != %s", p1, p2)
+	}
+	if p3 := s.GetFilePath(u3, true); p1 == p3 {
+		t.Errorf("Different queries should have different file paths, both are %s", p1)
+	}
+}
+
+func TestScrapeQueryPages(t *testing.T) {
+	site := testSite{
+		"/": `<html><body><a href="list?page=2">2</a><a href="list?page=3&utm_source=x">3</a>
+			<a href="list?utm_source=y">1</a><a href="list">1</a></body></html>`,
+	}
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/list" {
+			mu.Lock()
+			requests[r.URL.Query().Get("page")]++
+			mu.Unlock()
+			_, _ = w.Write([]byte("<html><body>page " + r.URL.Query().Get("page") + "</body></html>"))
+			return
+		}
+		site.ServeHTTP(w, r)
+	})
+
+	cfg := Config{
+		DropQueryParams: []string{"utm_*"},
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, handler, cfg, output)
+
+	for page, count := range requests {
+		if count != 1 {
+			t.Errorf("Page %q was requested %d times", page, count)
+		}
+	}
+	if len(requests) != 3 {
+		t.Errorf("Expected 3 different list pages to be requested but got %v", requests)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "list*.html"))
+	if err != nil {
+		t.Fatalf("Listing files failed: %v", err)
+	}
+	if len(files) != 3 {
+		t.Errorf("Expected 3 list files but got %v", files)
+	}
+
+	index, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatalf("Reading page failed: %v", err)
+	}
+	for _, file := range files {
+		if !strings.Contains(string(index), `href="`+filepath.Base(file)+`"`) {
+			t.Errorf("Page does not link to %s:\n%s", filepath.Base(file), index)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package scraper
+
+import "sync"
+
+// jobQueue is an unbounded FIFO queue that is safe for concurrent use.
+// Workers block in pop until a job is available or the queue got closed.
+type jobQueue struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	jobs   []interface{}
+	closed bool
+}
+
+func newJobQueue() *jobQueue {
+	q := &jobQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push adds a job to the end of the queue.
+func (q *jobQueue) push(job interface{}) {
+	q.mu.Lock()
+	q.jobs = append(q.jobs, job)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// pop returns the next job of the queue, it returns false if the queue
+// got closed.
+func (q *jobQueue) pop() (interface{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.jobs) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.jobs) == 0 {
+		return nil, false
+	}
+
+	job := q.jobs[0]
+	q.jobs[0] = nil
+	q.jobs = q.jobs[1:]
+	return job, true
+}
+
+// close wakes up all waiting workers and makes pop return false once the
+// queue is empty.
+func (q *jobQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// processedSet is a set of processed URLs that is safe for concurrent use.
+type processedSet struct {
+	mu sync.Mutex
+	m  map[string]struct{}
+}
+
+func newProcessedSet() *processedSet {
+	return &processedSet{
+		m: make(map[string]struct{}),
+	}
+}
+
+// add adds the key to the set and returns whether it was not part of the
+// set before.
+func (p *processedSet) add(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.m[key]; ok {
+		return false
+	}
+	p.m[key] = struct{}{}
+	return true
+}
+
+// remove removes the key from the set.
+func (p *processedSet) remove(key string) {
+	p.mu.Lock()
+	delete(p.m, key)
+	p.mu.Unlock()
+}
+
+// keys returns all keys of the set.
+func (p *processedSet) keys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]string, 0, len(p.m))
+	for key := range p.m {
+		keys = append(keys, key)
+	}
+	return keys
+}
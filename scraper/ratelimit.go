@@ -0,0 +1,136 @@
+package scraper
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// hostLimiter limits the request rate and the number of concurrent requests
+// per host. It is safe for concurrent use.
+type hostLimiter struct {
+	rate        float64       // requests per second, 0 for unlimited
+	maxInFlight uint          // concurrent requests, 0 for unlimited
+	jitter      time.Duration // max random delay before every request
+	now         func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimit
+}
+
+// hostLimit is the token bucket and the request slots of a single host.
+type hostLimit struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	slots chan struct{} // nil for unlimited concurrent requests
+}
+
+func newHostLimiter(rate float64, maxInFlight uint, jitter time.Duration) *hostLimiter {
+	return &hostLimiter{
+		rate:        rate,
+		maxInFlight: maxInFlight,
+		jitter:      jitter,
+		now:         time.Now,
+		hosts:       make(map[string]*hostLimit),
+	}
+}
+
+func (l *hostLimiter) host(host string) *hostLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostLimit{
+			tokens: l.burst(),
+			last:   l.now(),
+		}
+		if l.maxInFlight > 0 {
+			h.slots = make(chan struct{}, l.maxInFlight)
+		}
+		l.hosts[host] = h
+	}
+	return h
+}
+
+// burst returns the capacity of the token bucket, which allows the requests
+// of one second to be sent at once.
+func (l *hostLimiter) burst() float64 {
+	return math.Max(1, math.Floor(l.rate))
+}
+
+// acquire blocks until a request to the host of the URL may be sent or the
+// context gets cancelled. The returned function has to be called once the
+// request finished.
+func (l *hostLimiter) acquire(ctx context.Context, u *url.URL) (func(), error) {
+	h := l.host(u.Host)
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if h.slots != nil {
+			<-h.slots
+		}
+	}
+
+	if err := sleep(ctx, l.reserve(h)+l.randomJitter()); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// reserve takes a token from the bucket of the host and returns the time to
+// wait until the token is available.
+func (l *hostLimiter) reserve(h *hostLimit) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := l.now()
+	h.tokens = math.Min(l.burst(), h.tokens+now.Sub(h.last).Seconds()*l.rate)
+	h.last = now
+
+	// the token count goes negative for reserved tokens of waiting requests
+	h.tokens--
+	if h.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-h.tokens / l.rate * float64(time.Second))
+}
+
+func (l *hostLimiter) randomJitter() time.Duration {
+	if l.jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(l.jitter)))
+}
+
+// sleep pauses for the duration and returns the error of the context if it
+// got cancelled before.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
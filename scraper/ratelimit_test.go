@@ -0,0 +1,91 @@
+package scraper
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestHostLimiterRate(t *testing.T) {
+	l := newHostLimiter(10, 0, 0)
+	now := time.Now()
+	l.now = func() time.Time { return now }
+	h := l.host("example.com")
+
+	for i := 0; i < 10; i++ {
+		if wait := l.reserve(h); wait != 0 {
+			t.Fatalf("Request %d within burst had to wait %v", i, wait)
+		}
+	}
+
+	wait := l.reserve(h)
+	if wait != 100*time.Millisecond {
+		t.Errorf("Request after burst should wait 100ms but waited %v", wait)
+	}
+	wait = l.reserve(h)
+	if wait != 200*time.Millisecond {
+		t.Errorf("Second request after burst should wait 200ms but waited %v", wait)
+	}
+
+	// the bucket refills over time
+	now = now.Add(500 * time.Millisecond)
+	if wait = l.reserve(h); wait != 0 {
+		t.Errorf("Request after the reserved tokens refilled had to wait %v", wait)
+	}
+
+	if wait = l.reserve(l.host("other.com")); wait != 0 {
+		t.Errorf("Request to other host had to wait %v", wait)
+	}
+}
+
+func TestHostLimiterInFlight(t *testing.T) {
+	l := newHostLimiter(0, 2, 0)
+	u := &url.URL{Host: "example.com"}
+
+	ctx := context.Background()
+	release1, _ := l.acquire(ctx, u)
+	release2, _ := l.acquire(ctx, u)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, _ := l.acquire(ctx, u)
+		close(acquired)
+		release()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Third request was not limited")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release1()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Third request was not started after a request finished")
+	}
+	release2()
+}
+
+func TestHostLimiterCancel(t *testing.T) {
+	l := newHostLimiter(1, 1, 0)
+	u := &url.URL{Host: "example.com"}
+
+	release, err := l.acquire(context.Background(), u)
+	if err != nil {
+		t.Fatalf("Acquiring failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = l.acquire(ctx, u); err != context.DeadlineExceeded {
+		t.Errorf("Acquiring a full host should fail with the context error but got %v", err)
+	}
+
+	release()
+	if _, err = l.acquire(ctx, u); err != context.DeadlineExceeded {
+		t.Errorf("Waiting for the rate limit should fail with the context error but got %v", err)
+	}
+}
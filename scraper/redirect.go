@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"go.uber.org/zap"
+)
+
+// metaRefreshRe matches the delay and the rest of the content of a meta
+// refresh element, which can contain the target URL.
+var metaRefreshRe = regexp.MustCompile(`(?is)^\s*([0-9.]*)\s*[;,]?\s*(?:url\s*=\s*)?(.*)$`)
+
+// handleRedirects marks all redirect sources of a page download as
+// discovered and writes a redirect stub for every source that forwards to
+// the local copy of the target.
+func (s *Scraper) handleRedirects(resp *Response, target *url.URL, targetIsAPage bool, depth uint) {
+	for _, redirect := range resp.Redirects {
+		source := redirect.URL
+		s.log.Debug("Page was redirected",
+			zap.Stringer("URL", source),
+			zap.Stringer("location", target))
+
+		if source.Host != s.URL.Host {
+			continue // links to external pages are not relinked
+		}
+		s.pages.markDiscovered(s.pageKey(source), depth)
+		s.writeRedirectStub(source, target, targetIsAPage)
+	}
+}
+
+// writeRedirectStub writes a page at the file path of the source URL that
+// forwards to the local copy of the target URL, or the target URL itself
+// if it is an external page.
+func (s *Scraper) writeRedirectStub(source, target *url.URL, targetIsAPage bool) {
+	filePath := s.storageName(source, true)
+	ref := target.String()
+	if target.Host == s.URL.Host {
+		if filePath == s.storageName(target, targetIsAPage) {
+			return // the target itself is stored at the same path
+		}
+		ref = s.resolveURL(source, ref, targetIsAPage, s.urlRelativeToRoot(source))
+	}
+
+	if err := s.writeFile(filePath, redirectStub(ref)); err != nil {
+		s.log.Error("Writing redirect file failed",
+			zap.Stringer("URL", source),
+			zap.String("file", filePath),
+			zap.Error(err))
+		s.recordError(source, err)
+	}
+}
+
+// redirectStub returns a HTML page that forwards to the given reference.
+func redirectStub(ref string) *bytes.Buffer {
+	ref = html.EscapeString(ref)
+	return bytes.NewBufferString(fmt.Sprintf(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="0; url=%s"><link rel="canonical" href="%s"></head>
+<body><a href="%s">%s</a></body></html>
+`, ref, ref, ref, ref))
+}
+
+// metaRefreshElements returns the meta refresh elements of the document.
+func metaRefreshElements(doc *goquery.Selection) *goquery.Selection {
+	return doc.Find("meta[http-equiv]").FilterFunction(func(_ int, selection *goquery.Selection) bool {
+		equiv, _ := selection.Attr("http-equiv")
+		return strings.EqualFold(strings.TrimSpace(equiv), "refresh")
+	})
+}
+
+// parseMetaRefresh parses the content of a meta refresh element into the
+// delay and the target URL. It returns false if the content contains no
+// target URL.
+func parseMetaRefresh(content string) (string, string, bool) {
+	match := metaRefreshRe.FindStringSubmatch(content)
+	if match == nil {
+		return "", "", false
+	}
+	delay, target := match[1], strings.TrimSpace(match[2])
+	if target != "" && (target[0] == '"' || target[0] == '\'') {
+		quote := target[0]
+		target = target[1:]
+		if i := strings.IndexByte(target, quote); i != -1 {
+			target = target[:i]
+		}
+	}
+	if target == "" {
+		return "", "", false
+	}
+	if delay == "" {
+		delay = "0"
+	}
+	return delay, target, true
+}
+
+// metaRefreshTargets returns the URLs that the meta refresh elements of the
+// document forward to.
+func metaRefreshTargets(doc *goquery.Selection, base *url.URL) []*url.URL {
+	var targets []*url.URL
+	metaRefreshElements(doc).Each(func(_ int, selection *goquery.Selection) {
+		content, _ := selection.Attr("content")
+		_, target, ok := parseMetaRefresh(content)
+		if !ok {
+			return
+		}
+		ref, err := url.Parse(target)
+		if err != nil {
+			return
+		}
+		targets = append(targets, base.ResolveReference(ref))
+	})
+	return targets
+}
@@ -0,0 +1,70 @@
+package scraper
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMetaRefresh(t *testing.T) {
+	type result struct {
+		delay  string
+		target string
+		ok     bool
+	}
+	var fixtures = map[string]result{
+		"0; url=/new/":           {"0", "/new/", true},
+		"5;URL='page.html'":      {"5", "page.html", true},
+		` 3 , url = "a b.html" `: {"3", "a b.html", true},
+		"url=other.html":         {"0", "other.html", true},
+		"1; next.html":           {"1", "next.html", true},
+		"30":                     {"", "", false},
+		"":                       {"", "", false},
+	}
+
+	for input, expected := range fixtures {
+		delay, target, ok := parseMetaRefresh(input)
+		res := result{delay, target, ok}
+		if res != expected {
+			t.Errorf("Meta refresh %q should have been parsed to %v but was %v", input, expected, res)
+		}
+	}
+}
+
+func TestScrapeRedirects(t *testing.T) {
+	site := testSite{
+		"/": `<html><body><a href="old">old</a><a href="chain/start">chain</a>
+			<a href="refresh.html">refresh</a></body></html>`,
+		"/new/":         `<html><body><a href="../">home</a></body></html>`,
+		"/refresh.html": `<html><head><meta http-equiv="Refresh" content="0; url='/moved/page'"></head></html>`,
+		"/moved/page":   `<html><body>moved</body></html>`,
+	}
+	redirects := map[string]string{
+		"/old":         "/new/",
+		"/chain/start": "/chain/next",
+		"/chain/next":  "/new/",
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if location, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, location, http.StatusMovedPermanently)
+			return
+		}
+		site.ServeHTTP(w, r)
+	})
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, handler, Config{}, output)
+
+	stubs := map[string]string{
+		"old.html":         `url=new/index.html`,
+		"chain/start.html": `url=../new/index.html`,
+		"chain/next.html":  `url=../new/index.html`,
+	}
+	for file, refresh := range stubs {
+		assertContains(t, filepath.Join(dir, file), refresh)
+	}
+	assertStored(t, dir, "new/index.html", "moved/page.html")
+	assertContains(t, filepath.Join(dir, "refresh.html"), `content="0; url=moved/page.html"`)
+}
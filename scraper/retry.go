@@ -0,0 +1,227 @@
+package scraper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultRetryBackoff is the delay before the first retry of a failed
+	// request if none is configured.
+	DefaultRetryBackoff = time.Second
+
+	// maxRetryDelay is the longest time to wait before retrying a request,
+	// requests that should be retried later fail.
+	maxRetryDelay = 5 * time.Minute
+)
+
+// statusError is returned for responses with an unexpected HTTP status code.
+type statusError struct {
+	code       int
+	retryAfter string // value of the Retry-After header
+}
+
+func newStatusError(code int, header http.Header) *statusError {
+	return &statusError{
+		code:       code,
+		retryAfter: header.Get("Retry-After"),
+	}
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP status code %d", e.code)
+}
+
+// retryAfterTooLong returns whether the response of a failed request asks
+// to wait longer than the longest retry delay.
+func retryAfterTooLong(err error) bool {
+	se, ok := err.(*statusError)
+	if !ok || se.retryAfter == "" {
+		return false
+	}
+	delay, ok := parseRetryAfter(se.retryAfter, time.Now())
+	return ok && delay > maxRetryDelay
+}
+
+// isRetryable returns whether a failed request should be retried, which is
+// the case for network errors and server errors or rate limiting responses.
+func isRetryable(err error) bool {
+	if se, ok := err.(*statusError); ok {
+		return se.code >= 500 || se.code == http.StatusTooManyRequests
+	}
+	return !errors.Is(err, ErrBodyTooLarge) && !errors.Is(err, errRequestSkipped)
+}
+
+// retryDelay returns the time to wait before the given retry attempt
+// starting at 1. The Retry-After header of the response is honoured,
+// otherwise the delay grows exponentially with a random jitter. It returns
+// false if the request should not be retried now.
+func (s *Scraper) retryDelay(attempt uint, err error) (time.Duration, bool) {
+	if se, ok := err.(*statusError); ok && se.retryAfter != "" {
+		if delay, ok := parseRetryAfter(se.retryAfter, time.Now()); ok {
+			return delay, delay <= maxRetryDelay
+		}
+	}
+
+	delay := s.config.RetryBackoff << (attempt - 1)
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	// use a random delay between half and the full delay to spread the
+	// retries of concurrent requests
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	return delay, true
+}
+
+// parseRetryAfter parses the value of a Retry-After header, which is either
+// a number of seconds or a HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	delay := t.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	return delay, true
+}
+
+// retry calls the request function until it succeeds, fails with an error
+// that is not retryable, the retry limit is reached or the context gets
+// cancelled.
+func (s *Scraper) retry(ctx context.Context, u *url.URL, request func() error) error {
+	var attempt uint
+	for {
+		err := request()
+		if err == nil || !isRetryable(err) || attempt >= s.config.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		attempt++
+		delay, ok := s.retryDelay(attempt, err)
+		if !ok {
+			return err
+		}
+
+		s.log.Warn("Request failed, retrying",
+			zap.Stringer("URL", u),
+			zap.Uint("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+		if err = sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// addFailedPage remembers a page that failed with a retryable error to
+// retry it at the end of the scrape, unless the server asked to wait longer
+// than the longest retry delay.
+func (s *Scraper) addFailedPage(page pageJob, err error) {
+	if !isRetryable(err) || retryAfterTooLong(err) {
+		return
+	}
+	s.failedMu.Lock()
+	s.failedPages = append(s.failedPages, page)
+	s.failedMu.Unlock()
+}
+
+// addFailedAsset remembers an asset that failed with a retryable error to
+// retry it at the end of the scrape, unless the server asked to wait longer
+// than the longest retry delay.
+func (s *Scraper) addFailedAsset(u string, kind assetKind, err error) {
+	if !isRetryable(err) || retryAfterTooLong(err) {
+		return
+	}
+	s.failedMu.Lock()
+	s.failedAssets[u] = kind
+	s.failedMu.Unlock()
+}
+
+// retryFailed queues all failed pages and assets again and returns whether
+// any job was queued.
+func (s *Scraper) retryFailed() bool {
+	s.failedMu.Lock()
+	pages := s.failedPages
+	assets := s.failedAssets
+	s.failedPages = nil
+	s.failedAssets = make(map[string]assetKind)
+	s.failedMu.Unlock()
+
+	if len(pages) == 0 && len(assets) == 0 {
+		return false
+	}
+
+	s.log.Info("Retrying failed downloads",
+		zap.Int("pages", len(pages)),
+		zap.Int("assets", len(assets)))
+
+	s.failedMu.Lock()
+	for _, page := range pages {
+		delete(s.failures, page.URL.String())
+	}
+	for u := range assets {
+		delete(s.failures, u)
+	}
+	s.failedMu.Unlock()
+
+	for _, page := range pages {
+		s.jobs.Add(1)
+		if !s.pages.restore(s.pageKey(page.URL), page.URL, page.depth) {
+			s.jobs.Done()
+		}
+	}
+	for u, kind := range assets {
+		asset, err := url.Parse(u)
+		if err != nil {
+			continue
+		}
+		s.processed.remove(u)
+		s.queueAsset(asset, kind)
+	}
+	return true
+}
+
+// recordError remembers the error of a URL that failed to download or store
+// for the result of the scrape and reports it to the OnError hook.
+func (s *Scraper) recordError(u *url.URL, err error) {
+	s.failedMu.Lock()
+	s.failures[u.String()] = err
+	s.failedMu.Unlock()
+	s.onError(u, err)
+}
+
+// urlErrors returns an error that contains the errors of all failed URLs
+// sorted by URL, it returns nil if no URL failed.
+func (s *Scraper) urlErrors() error {
+	s.failedMu.Lock()
+	defer s.failedMu.Unlock()
+
+	urls := make([]string, 0, len(s.failures))
+	for u := range s.failures {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	var errs *multierror.Error
+	for _, u := range urls {
+		errs = multierror.Append(errs, fmt.Errorf("%s: %w", u, s.failures[u]))
+	}
+	return errs.ErrorOrNil()
+}
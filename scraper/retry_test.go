@@ -0,0 +1,143 @@
+package scraper
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	type fixture struct {
+		Value string
+		Delay time.Duration
+		Valid bool
+	}
+	var fixtures = []fixture{
+		{"120", 2 * time.Minute, true},
+		{" 5 ", 5 * time.Second, true},
+		{"Sun, 01 Mar 2020 12:00:30 GMT", 30 * time.Second, true},
+		{"Sun, 01 Mar 2020 11:00:00 GMT", 0, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+
+	for _, fix := range fixtures {
+		delay, ok := parseRetryAfter(fix.Value, now)
+		if ok != fix.Valid || delay != fix.Delay {
+			t.Errorf("Retry-After %q should be %v (%t) but was %v (%t)", fix.Value, fix.Delay, fix.Valid, delay, ok)
+		}
+	}
+}
+
+// flakySite fails the first requests of every path with the given status
+// code before it serves the test site.
+type flakySite struct {
+	site       testSite
+	failures   int
+	code       int
+	retryAfter string // Retry-After header of failures, 0 if empty
+
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func (f *flakySite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests[r.URL.Path]++
+	n := f.requests[r.URL.Path]
+	f.mu.Unlock()
+
+	if r.URL.Path != "/robots.txt" && n <= f.failures {
+		retryAfter := f.retryAfter
+		if retryAfter == "" {
+			retryAfter = "0"
+		}
+		w.Header().Set("Retry-After", retryAfter)
+		w.WriteHeader(f.code)
+		return
+	}
+	f.site.ServeHTTP(w, r)
+}
+
+func TestRetryFailedRequests(t *testing.T) {
+	site := &flakySite{
+		site: testSite{
+			"/":       `<html><body><a href="page">page</a><script src="app.js"></script></body></html>`,
+			"/page":   `<html><body>page</body></html>`,
+			"/app.js": "app",
+		},
+		failures: 2,
+		code:     http.StatusServiceUnavailable,
+		requests: make(map[string]int),
+	}
+
+	cfg := Config{
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, cfg, output)
+
+	assertStored(t, dir, "index.html", "page.html", "app.js")
+}
+
+func TestRetryFailedAtEnd(t *testing.T) {
+	site := &flakySite{
+		site: testSite{
+			"/":       `<html><body><a href="page">page</a><script src="app.js"></script></body></html>`,
+			"/page":   `<html><body>page</body></html>`,
+			"/app.js": "app",
+		},
+		failures: 1,
+		code:     http.StatusTooManyRequests,
+		requests: make(map[string]int),
+	}
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	// the start page fails without retries, so nothing can be discovered
+	dir, err := scrapeFailingTestSite(t, site, Config{}, output)
+	if err == nil || !strings.Contains(err.Error(), "/page: unexpected HTTP status code 429") {
+		t.Errorf("Scrape error should contain the failed page but was %v", err)
+	}
+
+	// the failed start page is retried at the end
+	assertStored(t, dir, "index.html")
+	assertNotStored(t, dir, "page.html", "app.js")
+}
+
+func TestRetryAfterTooLong(t *testing.T) {
+	site := &flakySite{
+		site: testSite{
+			"/":     `<html><body><a href="page">page</a></body></html>`,
+			"/page": `<html><body>page</body></html>`,
+		},
+		failures:   1,
+		code:       http.StatusServiceUnavailable,
+		retryAfter: "3600",
+		requests:   make(map[string]int),
+	}
+
+	cfg := Config{
+		MaxRetries:   2,
+		RetryBackoff: time.Millisecond,
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir, err := scrapeFailingTestSite(t, site, cfg, output)
+	if err == nil || !strings.Contains(err.Error(), "unexpected HTTP status code 503") {
+		t.Errorf("Scrape error should contain the failed start page but was %v", err)
+	}
+
+	// the start page is neither retried now nor at the end of the scrape
+	if n := site.requests["/"]; n != 1 {
+		t.Errorf("Start page should have been requested once but was requested %d times", n)
+	}
+	assertNotStored(t, dir, "index.html")
+}
@@ -0,0 +1,352 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultRobotsAgent is the user agent name that robots.txt rules are
+// matched against if none is configured and the user agent contains no
+// product name.
+const DefaultRobotsAgent = "goscrape"
+
+// robotsAgentOf returns the name of the product of a user agent, which
+// robots.txt rules are matched against. Browser like user agents name the
+// product in a comment, "Mozilla/5.0 (compatible; mybot/1.0)" is mybot.
+func robotsAgentOf(userAgent string) string {
+	agent := userAgent
+	if i := strings.Index(strings.ToLower(agent), "compatible;"); i != -1 {
+		agent = agent[i+len("compatible;"):]
+	}
+	agent = strings.TrimSpace(agent)
+	if i := strings.IndexAny(agent, "/ ;()"); i != -1 {
+		agent = agent[:i]
+	}
+	if agent == "" {
+		return DefaultRobotsAgent
+	}
+	return agent
+}
+
+// robotsTxt is a parsed robots.txt file.
+type robotsTxt struct {
+	groups   []*robotsGroup
+	sitemaps []string
+}
+
+// robotsGroup is a group of rules for a list of user agents.
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// parseRobots parses a robots.txt file. Unknown lines are ignored.
+func parseRobots(r io.Reader) *robotsTxt {
+	robots := &robotsTxt{}
+	var group *robotsGroup
+	lastWasAgent := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		value := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			// consecutive user agent lines share the same group
+			if !lastWasAgent {
+				group = &robotsGroup{}
+				robots.groups = append(robots.groups, group)
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+			lastWasAgent = true
+			continue
+
+		case "allow", "disallow":
+			// an empty disallow value allows everything
+			if group != nil && value != "" {
+				group.rules = append(group.rules, robotsRule{
+					allow:   key == "allow",
+					pattern: value,
+				})
+			}
+
+		case "crawl-delay":
+			if group != nil {
+				if delay, err := strconv.ParseFloat(value, 64); err == nil && delay > 0 {
+					group.crawlDelay = time.Duration(delay * float64(time.Second))
+				}
+			}
+
+		case "sitemap":
+			robots.sitemaps = append(robots.sitemaps, value)
+		}
+		lastWasAgent = false
+	}
+	return robots
+}
+
+// group returns the group that applies to the given user agent name. The
+// group with the longest matching agent name wins, the * group is used if
+// no group matches. It returns nil if no group applies.
+func (r *robotsTxt) group(agent string) *robotsGroup {
+	agent = strings.ToLower(agent)
+	var match, wildcard *robotsGroup
+	matchLen := 0
+
+	for _, group := range r.groups {
+		for _, name := range group.agents {
+			if name == "*" {
+				if wildcard == nil {
+					wildcard = group
+				}
+				continue
+			}
+			if strings.HasPrefix(agent, name) && len(name) > matchLen {
+				match = group
+				matchLen = len(name)
+			}
+		}
+	}
+
+	if match != nil {
+		return match
+	}
+	return wildcard
+}
+
+// allowed returns whether the given path including the query is allowed by
+// the group. The longest matching rule wins, allow rules win ties.
+func (g *robotsGroup) allowed(path string) bool {
+	allowed := true
+	matchLen := -1
+
+	for _, rule := range g.rules {
+		if !matchRobotsPattern(rule.pattern, path) {
+			continue
+		}
+		l := len(rule.pattern)
+		if l > matchLen || (l == matchLen && rule.allow) {
+			allowed = rule.allow
+			matchLen = l
+		}
+	}
+	return allowed
+}
+
+// matchRobotsPattern matches a path against a robots.txt pattern that can
+// contain * wildcards and a $ end anchor.
+func matchRobotsPattern(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+
+	parts := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			// the last part has to match at the end of the path
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx == -1 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+
+	return !anchored || pos == len(path)
+}
+
+// robotsFetchFunc requests a robots.txt file, it returns the response for
+// unexpected status codes as well.
+type robotsFetchFunc func(ctx context.Context, u *url.URL) (*Response, error)
+
+// robotsPolicy fetches and caches the robots.txt files of all hosts and
+// decides whether URLs may be downloaded. It is safe for concurrent use.
+type robotsPolicy struct {
+	log   *zap.Logger
+	get   robotsFetchFunc
+	agent string // user agent name to match rules against
+
+	mu    sync.Mutex
+	hosts map[string]*robotsHost
+}
+
+// robotsHost contains the robots.txt state of a single host.
+type robotsHost struct {
+	fetchMu  sync.Mutex
+	fetched  bool // a fetch that got cancelled is retried on next access
+	robots   *robotsTxt
+	group    *robotsGroup
+	disallow bool // robots.txt is unreachable, nothing may be downloaded
+
+	mu          sync.Mutex
+	nextRequest time.Time
+}
+
+func newRobotsPolicy(logger *zap.Logger, get robotsFetchFunc, agent string) *robotsPolicy {
+	return &robotsPolicy{
+		log:   logger,
+		get:   get,
+		agent: agent,
+		hosts: make(map[string]*robotsHost),
+	}
+}
+
+// host returns the robots.txt state of the host of the URL, the robots.txt
+// file gets downloaded on first access. It returns the error of the context
+// if it got cancelled before the file was downloaded.
+func (p *robotsPolicy) host(ctx context.Context, u *url.URL) (*robotsHost, error) {
+	key := u.Scheme + "://" + u.Host
+	p.mu.Lock()
+	h, ok := p.hosts[key]
+	if !ok {
+		h = &robotsHost{}
+		p.hosts[key] = h
+	}
+	p.mu.Unlock()
+
+	h.fetchMu.Lock()
+	defer h.fetchMu.Unlock()
+	if !h.fetched {
+		if err := p.fetch(ctx, key, h); err != nil {
+			return nil, err
+		}
+		h.fetched = true
+	}
+	return h, nil
+}
+
+// fetch downloads and parses the robots.txt file of a host. A missing file
+// allows everything, a server error or unreachable file disallows
+// everything. A file that the request hook rejected is handled like a
+// missing file. It only returns an error if the context got cancelled, the
+// result is not known in that case.
+func (p *robotsPolicy) fetch(ctx context.Context, root string, h *robotsHost) error {
+	robotsURL := root + "/robots.txt"
+	u, err := url.Parse(robotsURL)
+	if err != nil {
+		h.disallow = true
+		return nil
+	}
+
+	p.log.Debug("Downloading robots.txt", zap.String("URL", robotsURL))
+	resp, err := p.get(ctx, u)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	switch {
+	case errors.Is(err, errRequestSkipped):
+		// no robots.txt, everything is allowed
+
+	case resp == nil:
+		p.log.Warn("Downloading robots.txt failed, disallowing host",
+			zap.String("URL", robotsURL),
+			zap.Error(err))
+		h.disallow = true
+
+	case resp.StatusCode >= 500:
+		p.log.Warn("Downloading robots.txt failed, disallowing host",
+			zap.String("URL", robotsURL),
+			zap.Int("http_status_code", resp.StatusCode))
+		h.disallow = true
+
+	case resp.StatusCode >= 400:
+		// no robots.txt, everything is allowed
+
+	default:
+		h.robots = parseRobots(bytes.NewReader(resp.Body))
+		h.group = h.robots.group(p.agent)
+	}
+	return nil
+}
+
+// allowed returns whether the URL may be downloaded.
+func (p *robotsPolicy) allowed(ctx context.Context, u *url.URL) (bool, error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return true, nil
+	}
+
+	h, err := p.host(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	if h.disallow {
+		return false, nil
+	}
+	if h.group == nil {
+		return true, nil
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return h.group.allowed(path), nil
+}
+
+// sitemaps returns the sitemap URLs of the robots.txt file of the URL host.
+func (p *robotsPolicy) sitemaps(ctx context.Context, u *url.URL) []string {
+	h, err := p.host(ctx, u)
+	if err != nil || h.robots == nil {
+		return nil
+	}
+	return h.robots.sitemaps
+}
+
+// wait blocks until the crawl delay of the host of the URL has passed since
+// the last request to the host or the context gets cancelled.
+func (p *robotsPolicy) wait(ctx context.Context, u *url.URL) error {
+	h, err := p.host(ctx, u)
+	if err != nil {
+		return err
+	}
+	if h.group == nil || h.group.crawlDelay == 0 {
+		return nil
+	}
+
+	h.mu.Lock()
+	now := time.Now()
+	next := h.nextRequest
+	if next.Before(now) {
+		next = now
+	}
+	h.nextRequest = next.Add(h.group.crawlDelay)
+	h.mu.Unlock()
+
+	return sleep(ctx, next.Sub(now))
+}
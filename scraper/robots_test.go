@@ -0,0 +1,225 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zaptest"
+)
+
+const testRobots = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/public.html
+Disallow: /*.php$
+
+User-agent: goscrape
+User-agent: otherbot
+Disallow: /secret
+Allow: /secret/open
+Crawl-delay: 0.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+
+func TestRobotsGroup(t *testing.T) {
+	robots := parseRobots(strings.NewReader(testRobots))
+
+	if len(robots.sitemaps) != 1 || robots.sitemaps[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("Unexpected sitemaps %v", robots.sitemaps)
+	}
+
+	group := robots.group("goscrape/1.0")
+	if group == nil || group.crawlDelay != 500*time.Millisecond {
+		t.Fatal("Group for goscrape was not found")
+	}
+
+	var fixtures = map[string]bool{
+		"/":              true,
+		"/private/":      true,
+		"/secret":        false,
+		"/secret/x":      false,
+		"/secret/open":   true,
+		"/secret/open/x": true,
+	}
+	for path, expected := range fixtures {
+		if allowed := group.allowed(path); allowed != expected {
+			t.Errorf("Path %s for goscrape should be allowed %t but was %t", path, expected, allowed)
+		}
+	}
+
+	group = robots.group("somebot")
+	if group == nil {
+		t.Fatal("Wildcard group was not found")
+	}
+
+	fixtures = map[string]bool{
+		"/":                    true,
+		"/secret":              true,
+		"/private/x":           false,
+		"/private/public.html": true,
+		"/index.php":           false,
+		"/index.php?x=1":       true,
+		"/index.phpx":          true,
+		"/dir/file.php":        false,
+	}
+	for path, expected := range fixtures {
+		if allowed := group.allowed(path); allowed != expected {
+			t.Errorf("Path %s for somebot should be allowed %t but was %t", path, expected, allowed)
+		}
+	}
+}
+
+func TestRobotsAgentOf(t *testing.T) {
+	var fixtures = map[string]string{
+		DefaultUserAgent: "goscrape",
+		"mybot/1.0":      "mybot",
+		"mybot":          "mybot",
+		"Mozilla/5.0 (compatible; Otherbot/2.1; +http://example.org/bot)": "Otherbot",
+		"Mozilla/5.0 (X11; Linux x86_64)":                                 "Mozilla",
+		" ":                                                               DefaultRobotsAgent,
+	}
+	for userAgent, expected := range fixtures {
+		if agent := robotsAgentOf(userAgent); agent != expected {
+			t.Errorf("Robots agent of %q should be %q but was %q", userAgent, expected, agent)
+		}
+	}
+}
+
+func TestMatchRobotsPattern(t *testing.T) {
+	type fixture struct {
+		Pattern string
+		Path    string
+		Match   bool
+	}
+
+	var fixtures = []fixture{
+		{"/", "/anything", true},
+		{"/fish", "/fish.html", true},
+		{"/fish", "/Fish", false},
+		{"/fish$", "/fish", true},
+		{"/fish$", "/fish/", false},
+		{"/*.php", "/a/b.php?x", true},
+		{"/*.php$", "/a/b.php?x", false},
+		{"/a*b*c", "/axxbyyc", true},
+		{"/a*b*c", "/axxcyyb", false},
+		{"/*a*b$", "/xaxb", true},
+	}
+
+	for _, fix := range fixtures {
+		if match := matchRobotsPattern(fix.Pattern, fix.Path); match != fix.Match {
+			t.Errorf("Pattern %s for path %s should match %t but was %t", fix.Pattern, fix.Path, fix.Match, match)
+		}
+	}
+}
+
+func TestRobotsDisallowedPage(t *testing.T) {
+	site := testSite{
+		"/robots.txt": "User-agent: *\nDisallow: /private\n",
+		"/":           `<html><body><a href="public">a</a><a href="private">b</a></body></html>`,
+		"/public":     `<html><body>public</body></html>`,
+		"/private":    `<html><body>private</body></html>`,
+	}
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, Config{}, output)
+
+	assertStored(t, dir, "public.html")
+	assertNotStored(t, dir, "private.html")
+}
+
+func TestRobotsResumeWithHostConcurrency(t *testing.T) {
+	site := testSite{
+		"/robots.txt": "User-agent: *\nDisallow: /private\n",
+		"/a":          `<html><body><a href="b">b</a></body></html>`,
+		"/b":          `<html><body>b</body></html>`,
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	cfg := Config{
+		URL:             server.URL,
+		OutputDirectory: output,
+		Resume:          true,
+		HostConcurrency: 1,
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	// the resumed page is downloaded before robots.txt was checked
+	c := checkpoint{
+		URL:    server.URL,
+		Pages:  []checkpointPage{{URL: server.URL + "/a", Depth: 1}},
+		Depths: map[string]uint{"/": 0, "/a": 1},
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatalf("Encoding checkpoint failed: %v", err)
+	}
+	if err = s.storage.Write(s.checkpointName(), b); err != nil {
+		t.Fatalf("Writing checkpoint failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = s.StartContext(ctx); err != nil {
+		t.Fatalf("Scraping failed: %v", err)
+	}
+
+	dir := filepath.Join(output, s.hostDirectory())
+	assertStored(t, dir, "a.html", "b.html")
+}
+
+func TestRobotsCancelledFetch(t *testing.T) {
+	site := &blockingSite{
+		site: testSite{
+			"/robots.txt": "User-agent: *\nDisallow: /private\n",
+		},
+		path:     "/robots.txt",
+		blocking: 1,
+		started:  make(chan struct{}),
+	}
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	s, err := New(zaptest.NewLogger(t), Config{URL: server.URL})
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	u, _ := url.Parse(server.URL + "/public")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-site.started
+		cancel()
+	}()
+	if _, err = s.isAllowedByRobots(ctx, u); !errors.Is(err, context.Canceled) {
+		t.Errorf("Cancelled robots.txt download should return the context error but got %v", err)
+	}
+
+	// the cancelled download is not cached as an unreachable robots.txt
+	atomic.StoreInt32(&site.blocking, 0)
+	allowed, err := s.isAllowedByRobots(context.Background(), u)
+	if err != nil || !allowed {
+		t.Errorf("Page should be allowed after the cancelled download but got %v, %v", allowed, err)
+	}
+	u.Path = "/private"
+	if allowed, _ = s.isAllowedByRobots(context.Background(), u); allowed {
+		t.Error("Page disallowed by robots.txt was allowed")
+	}
+}
@@ -0,0 +1,180 @@
+package scraper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// maxSegmentLength is the max length in bytes of a file or directory
+	// name, longer names are truncated and get a hash suffix.
+	maxSegmentLength = 200
+	// maxExtensionLength is the max length of a file extension that is
+	// kept when a file name is truncated.
+	maxExtensionLength = 16
+	// pathHashLength is the number of hex characters of hash suffixes.
+	pathHashLength = 8
+
+	// PathsFile is the file name of the unique file paths that get stored
+	// in the directory of the website host, it keeps the file names of
+	// paths that only differ in case stable between scrapes.
+	PathsFile = ".goscrape-paths.json"
+)
+
+// reservedNames contains file names that can not be used on Windows,
+// regardless of their extension.
+var reservedNames = map[string]struct{}{
+	"con": {}, "prn": {}, "aux": {}, "nul": {},
+	"com1": {}, "com2": {}, "com3": {}, "com4": {}, "com5": {}, "com6": {}, "com7": {}, "com8": {}, "com9": {},
+	"lpt1": {}, "lpt2": {}, "lpt3": {}, "lpt4": {}, "lpt5": {}, "lpt6": {}, "lpt7": {}, "lpt8": {}, "lpt9": {},
+}
+
+// pathHash returns a short hash of the string to use as file name suffix.
+func pathHash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])[:pathHashLength]
+}
+
+// isIllegalPathChar returns whether the character can not be used in file
+// names on common file systems.
+func isIllegalPathChar(c byte) bool {
+	return c < 0x20 || c == 0x7f || strings.IndexByte(`<>:"\|?*`, c) != -1
+}
+
+// sanitizePath returns a relative file path for a slash separated URL path
+// that stays inside of the directory that it is joined to. Dot segments,
+// characters that are illegal in file names and reserved names are escaped
+// and overlong segments are truncated. Applying it to a sanitized path
+// returns the same path.
+func sanitizePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = sanitizeSegment(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// sanitizeSegment returns a file or directory name that is valid on common
+// file systems for a path segment.
+func sanitizeSegment(segment string) string {
+	switch segment {
+	case "":
+		return ""
+	case ".", "..":
+		return strings.Repeat("%2E", len(segment))
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		// trailing dots and spaces are removed by Windows
+		trailing := i == len(segment)-1 && (c == '.' || c == ' ')
+		if isIllegalPathChar(c) || trailing {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	segment = b.String()
+
+	name := strings.ToLower(segment)
+	if i := strings.IndexByte(name, '.'); i != -1 {
+		name = name[:i]
+	}
+	if _, ok := reservedNames[name]; ok {
+		segment = "_" + segment
+	}
+
+	if len(segment) > maxSegmentLength {
+		ext := path.Ext(segment)
+		if len(ext) > maxExtensionLength {
+			ext = ""
+		}
+		suffix := "_" + pathHash(segment) + ext
+		prefix := segment[:maxSegmentLength-len(suffix)]
+		// do not cut a multi byte character
+		for len(prefix) > 0 && !utf8.ValidString(prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+		segment = prefix + suffix
+	}
+	return segment
+}
+
+// pathRegistry assigns unique file paths on file systems that are not case
+// sensitive. The first path that is registered keeps its name, paths that
+// only differ in case from it get a hash suffix. The registered paths are
+// stored with the scrape to assign the same names on the next scrape.
+// It is safe for concurrent use.
+type pathRegistry struct {
+	mu    sync.Mutex
+	paths map[string]string // lower case path to the registered path
+}
+
+func newPathRegistry() *pathRegistry {
+	return &pathRegistry{
+		paths: make(map[string]string),
+	}
+}
+
+// localPath returns the unique sanitized file path for the slash separated
+// path relative to the mirror root.
+func (r *pathRegistry) localPath(p string) string {
+	p = sanitizePath(strings.TrimPrefix(p, "/"))
+	key := strings.ToLower(p)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	registered, ok := r.paths[key]
+	if !ok || registered == p {
+		r.paths[key] = p
+		return p
+	}
+
+	unique := addFileSuffix(p, "_"+pathHash(p))
+	r.paths[strings.ToLower(unique)] = unique
+	return unique
+}
+
+// marshal returns the registered paths as JSON.
+func (r *pathRegistry) marshal() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Marshal(r.paths)
+}
+
+// unmarshal registers the paths of a previous scrape.
+func (r *pathRegistry) unmarshal(b []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return json.Unmarshal(b, &r.paths)
+}
+
+// loadPaths loads the unique file paths of a previous scrape.
+func (s *Scraper) loadPaths() error {
+	b, err := s.storage.Read(path.Join(s.stateDirectory, PathsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return s.paths.unmarshal(b)
+}
+
+// writePaths writes the unique file paths of all stored URLs.
+func (s *Scraper) writePaths() error {
+	b, err := s.paths.marshal()
+	if err != nil {
+		return err
+	}
+	return s.storage.Write(path.Join(s.stateDirectory, PathsFile), b)
+}
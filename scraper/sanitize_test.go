@@ -0,0 +1,154 @@
+package scraper
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSanitizePath(t *testing.T) {
+	long := strings.Repeat("a", 300)
+
+	var fixtures = map[string]string{
+		"/docs/page.html":      "/docs/page.html",
+		"/../../etc/passwd":    "/%2E%2E/%2E%2E/etc/passwd",
+		"/a/./b":               "/a/%2E/b",
+		"/what?.html":          "/what%3F.html",
+		`/a:b/c"d<e>f|g*h\i`:   `/a%3Ab/c%22d%3Ce%3Ef%7Cg%2Ah%5Ci`,
+		"/tab\there":           "/tab%09here",
+		"/trailing./space ":    "/trailing%2E/space%20",
+		"/con/aux.txt/nul.tar": "/_con/_aux.txt/_nul.tar",
+		"/console":             "/console",
+		"/" + long + ".html":   "/" + long[:200-len("_12345678.html")] + "_" + pathHash(long+".html") + ".html",
+	}
+
+	for input, expected := range fixtures {
+		output := sanitizePath(input)
+		if output != expected {
+			t.Errorf("Path %s should have been sanitized to %s but was %s", input, expected, output)
+		}
+		if again := sanitizePath(output); again != output {
+			t.Errorf("Sanitizing path %s again changed it to %s", output, again)
+		}
+	}
+}
+
+func TestGetFilePathSanitized(t *testing.T) {
+	cfg := Config{
+		URL:             "http://localhost",
+		OutputDirectory: "mirror",
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	root := filepath.Join("mirror", "localhost") + string(filepath.Separator)
+
+	var fixtures = []string{
+		"http://localhost/%2e%2e/%2e%2e/etc/passwd",
+		"http://localhost/a/..%2f..%2f..%2fsecret",
+		"http://example.org/%2e%2e/%2e%2e/x.png",
+		"http://localhost/" + strings.Repeat("x", 1000),
+	}
+	for _, fixture := range fixtures {
+		u, err := url.Parse(fixture)
+		if err != nil {
+			t.Fatalf("URL parse failed: %v", err)
+		}
+		for _, isAPage := range []bool{true, false} {
+			p := s.GetFilePath(u, isAPage)
+			if !strings.HasPrefix(p, root) {
+				t.Errorf("File path %s of URL %s is outside of the mirror root", p, fixture)
+			}
+			for _, segment := range strings.Split(p, string(filepath.Separator)) {
+				if len(segment) > maxSegmentLength {
+					t.Errorf("File path %s has a segment that is too long", p)
+				}
+			}
+		}
+	}
+}
+
+func TestPathRegistryCaseCollisions(t *testing.T) {
+	r := newPathRegistry()
+
+	first := r.localPath("/Docs/Readme.html")
+	if first != "Docs/Readme.html" {
+		t.Errorf("First path should keep its name but was %s", first)
+	}
+	second := r.localPath("/docs/readme.html")
+	if strings.EqualFold(first, second) {
+		t.Errorf("Paths that only differ in case should not collide: %s and %s", first, second)
+	}
+	if again := r.localPath("/docs/readme.html"); again != second {
+		t.Errorf("Path should map to %s again but was %s", second, again)
+	}
+	if again := r.localPath("/Docs/Readme.html"); again != first {
+		t.Errorf("Path should map to %s again but was %s", first, again)
+	}
+
+	// the next scrape can register the paths in a different order
+	b, err := r.marshal()
+	if err != nil {
+		t.Fatalf("Marshaling paths failed: %v", err)
+	}
+	loaded := newPathRegistry()
+	if err = loaded.unmarshal(b); err != nil {
+		t.Fatalf("Unmarshaling paths failed: %v", err)
+	}
+	if again := loaded.localPath("/docs/readme.html"); again != second {
+		t.Errorf("Loaded path should map to %s again but was %s", second, again)
+	}
+	if again := loaded.localPath("/Docs/Readme.html"); again != first {
+		t.Errorf("Loaded path should map to %s again but was %s", first, again)
+	}
+}
+
+func TestGetFilePathHostPort(t *testing.T) {
+	cfg := Config{
+		URL:             "http://localhost:8080",
+		OutputDirectory: "mirror",
+	}
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+
+	var fixtures = map[string]string{
+		"http://localhost:8080/a.png":   "localhost%3A8080/a.png",
+		"http://example.org:8080/b.png": "localhost%3A8080/_example.org%3A8080/b.png",
+	}
+	for input, expected := range fixtures {
+		u, err := url.Parse(input)
+		if err != nil {
+			t.Fatalf("URL parse failed: %v", err)
+		}
+		if p := s.GetFilePath(u, false); p != filepath.Join("mirror", filepath.FromSlash(expected)) {
+			t.Errorf("File path of URL %s should be %s but was %s", input, expected, p)
+		}
+	}
+}
+
+func TestResolveURLSanitized(t *testing.T) {
+	s, err := New(zaptest.NewLogger(t), Config{URL: "http://localhost"})
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	base, _ := url.Parse("http://localhost/dir/")
+
+	var fixtures = map[string]string{
+		"./a:b":           "a%253Ab.html",
+		"what%3F":         "what%253F.html",
+		"../%2e%2e/x.png": "../%252E%252E/x.png",
+	}
+	for reference, expected := range fixtures {
+		isAPage := !strings.HasSuffix(reference, ".png")
+		resolved := s.resolveURL(base, reference, isAPage, "../")
+		if resolved != expected {
+			t.Errorf("Reference %s should be resolved to %s but was %s", reference, expected, resolved)
+		}
+	}
+}
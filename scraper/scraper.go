@@ -2,17 +2,19 @@ package scraper
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
-	"os"
+	"path"
 	"regexp"
+	"sync"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/hashicorp/go-multierror"
-	"github.com/headzoo/surf"
-	"github.com/headzoo/surf/agent"
-	"github.com/headzoo/surf/browser"
 	"go.uber.org/zap"
 )
 
@@ -22,30 +24,135 @@ type Config struct {
 	Includes []string
 	Excludes []string
 
-	ImageQuality uint // image quality from 0 to 100%, 0 to disable reencoding
-	MaxDepth     uint // download depth, 0 for unlimited
-	Timeout      uint // time limit in seconds to process each http request
+	ImageQuality uint  // image quality from 0 to 100%, 0 to disable reencoding
+	MaxDepth     uint  // download depth, 0 for unlimited
+	MaxMediaSize int64 // max size in bytes of audio, video and embedded files, 0 for unlimited
+	Timeout      uint  // time limit in seconds to process each http request
+
+	UserAgent string      // user agent to send, defaults to DefaultUserAgent
+	Headers   http.Header // additional headers to send with every request
+
+	RateLimit       float64       // max requests per second per host, 0 for unlimited
+	HostConcurrency uint          // max concurrent requests per host, 0 for unlimited
+	Jitter          time.Duration // max random delay to add before every request
+
+	MaxRetries   uint          // number of retries of failed requests
+	RetryBackoff time.Duration // delay before the first retry, doubles for every further retry
+
+	Concurrency      uint // number of pages to download concurrently, 0 for 1
+	AssetConcurrency uint // number of assets to download concurrently, 0 for 1
+
+	Frontier FrontierMode // order of page downloads, defaults to FrontierBFS
+
+	Query           QueryMode // handling of URL query strings, defaults to QueryKeep
+	DropQueryParams []string  // patterns of query parameter names to ignore, like utm_*
 
 	OutputDirectory string
 	Username        string
 	Password        string
+
+	WARCPrefix  string // path prefix of WARC files to write, empty to disable
+	WARCMaxSize int64  // size in bytes after which a new WARC file is started
+
+	Resume      bool // continue a previous scrape from its checkpoint file
+	Deduplicate bool // store identical asset contents only once and hardlink the asset files
+	Sitemaps    bool // queue the pages of the sitemaps of the website
+
+	IgnoreRobots bool   // do not download and honour robots.txt files
+	RobotsAgent  string // user agent name to match robots.txt rules against, defaults to the product of the user agent
+
+	Fetcher Fetcher // downloads all pages, assets and robots.txt files, defaults to a surf browser based fetcher
+	Storage Storage // stores the mirror files, defaults to a local storage of the output directory
 }
 
+// DefaultUserAgent is the user agent that is sent if none is configured.
+const DefaultUserAgent = "Mozilla/5.0 (compatible; goscrape; +https://github.com/cornelk/goscrape)"
+
 // Scraper contains all scraping data.
 type Scraper struct {
 	config  Config
 	log     *zap.Logger
 	URL     *url.URL
-	browser *browser.Browser
+	fetcher Fetcher
+	storage Storage
 
-	cssURLRe *regexp.Regexp
-	includes []*regexp.Regexp
-	excludes []*regexp.Regexp
+	headers http.Header   // user agent and configured headers
+	robots  *robotsPolicy // nil if robots.txt files are ignored
+	limiter *hostLimiter
+
+	paths *pathRegistry // unique file paths of all stored URLs
+	// directory of the configured website host that the state of the
+	// scrape is stored in, it does not change if the start page redirects
+	stateDirectory string
+	cssURLRe       *regexp.Regexp
+	includes       []*regexp.Regexp
+	excludes       []*regexp.Regexp
 
 	// key is the URL of page or asset
-	processed map[string]struct{}
+	processed *processedSet
+
+	pages  *frontier
+	assets *jobQueue
+	jobs   sync.WaitGroup // counts queued and running page and asset jobs
+
+	// queued and running asset jobs by URL, used for checkpoints
+	pendingAssetsMu sync.Mutex
+	pendingAssets   map[string]assetKind
+
+	// downloads that failed with retryable errors and the errors of all
+	// failed URLs
+	failedMu     sync.Mutex
+	failedPages  []pageJob
+	failedAssets map[string]assetKind
+	failures     map[string]error
+
+	validators *validatorStore
+	warc       *warcWriter  // nil if no WARC files are written
+	objects    *objectStore // nil if deduplication is disabled
+
+	imagesQueueMu sync.Mutex
+	imagesQueue   []*url.URL
 
-	imagesQueue []*browser.DownloadableAsset
+	running bool // set once the workers run, s.URL is not modified anymore
+
+	// Processors transform the downloaded content before it gets stored,
+	// the built-in processors that relink the references are registered
+	// by New. Processors have to be registered before Start is called.
+	Processors *ProcessorRegistry
+
+	// The hooks have to be set before Start is called, they are called
+	// concurrently by the page and asset workers.
+
+	// OnRequest is called before a page, asset or robots.txt file is
+	// requested, it can modify the request headers. Returning false skips
+	// the URL, a skipped robots.txt file allows everything.
+	OnRequest func(req *Request) bool
+	// OnResponse is called for every response, including responses with
+	// an unexpected status code.
+	OnResponse func(resp *Response)
+	// OnPageStored is called with the storage file name of a stored page.
+	OnPageStored func(u *url.URL, name string)
+	// OnAssetStored is called with the storage file name of a stored asset
+	// or linked download.
+	OnAssetStored func(u *url.URL, name string)
+	// OnSkip is called for discovered URLs that are not downloaded, a URL
+	// can be reported once for every page that links to it.
+	OnSkip func(u *url.URL, reason SkipReason)
+	// OnError is called for URLs that failed to download or store.
+	OnError func(u *url.URL, err error)
+}
+
+// pageJob is a page that is queued for downloading.
+type pageJob struct {
+	URL   *url.URL
+	depth uint
+	seq   uint64 // frontier sequence number
+}
+
+// assetJob is an asset that is queued for downloading.
+type assetJob struct {
+	URL  *url.URL
+	kind assetKind
 }
 
 // New creates a new Scraper instance.
@@ -66,6 +173,26 @@ func New(logger *zap.Logger, cfg Config) (*Scraper, error) {
 		errs = multierror.Append(errs, err)
 	}
 
+	switch cfg.Frontier {
+	case "":
+		cfg.Frontier = FrontierBFS
+	case FrontierBFS, FrontierPriority:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unsupported frontier mode %q", cfg.Frontier))
+	}
+	switch cfg.Query {
+	case "":
+		cfg.Query = QueryKeep
+	case QueryKeep, QueryDrop:
+	default:
+		errs = multierror.Append(errs, fmt.Errorf("unsupported query mode %q", cfg.Query))
+	}
+	for _, pattern := range cfg.DropQueryParams {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid query parameter pattern %q: %w", pattern, err))
+		}
+	}
+
 	if errs != nil {
 		return nil, errs.ErrorOrNil()
 	}
@@ -74,20 +201,69 @@ func New(logger *zap.Logger, cfg Config) (*Scraper, error) {
 		u.Scheme = "http" // if no URL scheme was given default to http
 	}
 
-	b := surf.NewBrowser()
-	b.SetUserAgent(agent.GoogleBot())
-	b.SetTimeout(time.Duration(cfg.Timeout) * time.Second)
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 1
+	}
+	if cfg.AssetConcurrency == 0 {
+		cfg.AssetConcurrency = 1
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	if cfg.RobotsAgent == "" {
+		cfg.RobotsAgent = robotsAgentOf(cfg.UserAgent)
+	}
+	if cfg.RetryBackoff == 0 {
+		cfg.RetryBackoff = DefaultRetryBackoff
+	}
+
+	headers := cfg.Headers.Clone()
+	if headers == nil {
+		headers = make(http.Header)
+	}
+	headers.Set("User-Agent", cfg.UserAgent)
 
 	s := &Scraper{
 		config: cfg,
 
-		browser:   b,
-		log:       logger,
-		processed: make(map[string]struct{}),
-		URL:       u,
-		cssURLRe:  regexp.MustCompile(`^url\(['"]?(.*?)['"]?\)$`),
-		includes:  includes,
-		excludes:  excludes,
+		fetcher:        cfg.Fetcher,
+		storage:        cfg.Storage,
+		headers:        headers,
+		limiter:        newHostLimiter(cfg.RateLimit, cfg.HostConcurrency, cfg.Jitter),
+		log:            logger,
+		processed:      newProcessedSet(),
+		pages:          newFrontier(cfg.Frontier),
+		paths:          newPathRegistry(),
+		stateDirectory: sanitizeSegment(u.Host),
+		assets:         newJobQueue(),
+		pendingAssets:  make(map[string]assetKind),
+		failedAssets:   make(map[string]assetKind),
+		failures:       make(map[string]error),
+		validators:     newValidatorStore(),
+		URL:            u,
+		cssURLRe:       regexp.MustCompile(`^url\(['"]?(.*?)['"]?\)$`),
+		includes:       includes,
+		excludes:       excludes,
+	}
+	if !cfg.IgnoreRobots {
+		s.robots = newRobotsPolicy(logger, s.fetchRobots, cfg.RobotsAgent)
+	}
+	if cfg.WARCPrefix != "" {
+		s.warc = newWARCWriter(cfg.WARCPrefix, cfg.WARCMaxSize, cfg.UserAgent)
+	}
+	if s.fetcher == nil {
+		s.fetcher = newSurfFetcher(time.Duration(cfg.Timeout) * time.Second)
+	}
+	if s.storage == nil {
+		s.storage = NewLocalStorage(cfg.OutputDirectory)
+	}
+	s.registerProcessors()
+	if cfg.Deduplicate {
+		if _, ok := s.storage.(linker); ok {
+			s.objects = newObjectStore()
+		} else {
+			logger.Warn("Storage does not support hardlinks, deduplication is disabled")
+		}
 	}
 	return s, nil
 }
@@ -110,90 +286,323 @@ func compileRegexps(sl []string) ([]*regexp.Regexp, error) {
 
 // Start starts the scraping
 func (s *Scraper) Start() error {
-	if s.config.OutputDirectory != "" {
-		if err := os.MkdirAll(s.config.OutputDirectory, os.ModePerm); err != nil {
+	return s.StartContext(context.Background())
+}
+
+// StartContext starts the scraping and returns once all pages and assets
+// were processed or the context got cancelled. On cancellation running
+// requests are aborted and the checkpoint is kept to resume the scrape.
+// The returned error contains the errors of all URLs that failed and the
+// error of the context if it got cancelled.
+func (s *Scraper) StartContext(ctx context.Context) error {
+	if err := s.loadValidators(); err != nil {
+		return err
+	}
+	if err := s.loadPaths(); err != nil {
+		return err
+	}
+
+	resumed := false
+	if s.config.Resume {
+		var err error
+		if resumed, err = s.loadCheckpoint(); err != nil {
 			return err
 		}
 	}
+	if !resumed {
+		allowed, err := s.isAllowedByRobots(ctx, s.URL)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return fmt.Errorf("URL %s is disallowed by robots.txt", s.URL)
+		}
+		s.queuePage(s.URL, 0)
+		// the start page is processed before the workers get started, a
+		// redirect of it changes the URL of the scrape
+		if page, ok := s.pages.pop(); ok {
+			s.processPage(ctx, page)
+		}
+	}
 
-	p := s.URL.Path
-	if p == "" {
-		p = "/"
+	s.run(ctx)
+
+	var errs *multierror.Error
+	if err := ctx.Err(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := s.urlErrors(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if s.warc != nil {
+		if err := s.warc.close(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	if err := s.writeValidators(); err != nil {
+		errs = multierror.Append(errs, err)
 	}
-	s.processed[p] = struct{}{}
+	if err := s.writePaths(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	s.logDeduplication()
 
-	if s.config.Username != "" {
-		auth := base64.StdEncoding.EncodeToString([]byte(s.config.Username + ":" + s.config.Password))
-		s.browser.AddRequestHeader("Authorization", "Basic "+auth)
+	if ctx.Err() != nil {
+		if err := s.writeCheckpoint(); err != nil {
+			errs = multierror.Append(errs, err)
+		} else {
+			s.log.Info("Scrape was cancelled, it can be resumed from the checkpoint")
+		}
+	} else if err := s.removeCheckpoint(); err != nil {
+		errs = multierror.Append(errs, err)
 	}
+	return errs.ErrorOrNil()
+}
 
-	s.downloadPage(s.URL, 0)
-	return nil
+// run starts the page and asset workers and waits until all queued jobs
+// have been processed. Once the context gets cancelled the workers move the
+// remaining jobs to the failed jobs without downloading them.
+func (s *Scraper) run(ctx context.Context) {
+	// the URL of the scrape does not change anymore once the workers run
+	s.running = true
+
+	var workers sync.WaitGroup
+	for i := uint(0); i < s.config.Concurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.pageWorker(ctx)
+		}()
+	}
+	for i := uint(0); i < s.config.AssetConcurrency; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			s.assetWorker(ctx)
+		}()
+	}
+
+	stopCheckpoints := make(chan struct{})
+	checkpointsStopped := make(chan struct{})
+	go func() {
+		defer close(checkpointsStopped)
+		s.writeCheckpoints(stopCheckpoints)
+	}()
+
+	// jobs get queued by running jobs, once the counter drops to zero
+	// no new jobs can appear anymore
+	s.jobs.Wait()
+	if ctx.Err() == nil && s.retryFailed() {
+		s.jobs.Wait()
+	}
+	s.pages.close()
+	s.assets.close()
+	workers.Wait()
+
+	close(stopCheckpoints)
+	<-checkpointsStopped
+}
+
+func (s *Scraper) basicAuth() string {
+	auth := base64.StdEncoding.EncodeToString([]byte(s.config.Username + ":" + s.config.Password))
+	return "Basic " + auth
+}
+
+// requestHeaders returns the headers to send with a request for the URL.
+// Credentials are only sent to the host of the scraped website.
+func (s *Scraper) requestHeaders(u *url.URL) http.Header {
+	h := s.headers.Clone()
+	if s.config.Username != "" && u.Host == s.URL.Host {
+		h.Set("Authorization", s.basicAuth())
+	}
+	return h
 }
 
-func (s *Scraper) downloadPage(u *url.URL, currentDepth uint) {
+// queuePage adds a page to the frontier unless it was already discovered
+// at the same or a lower depth.
+func (s *Scraper) queuePage(u *url.URL, depth uint) {
+	// the job has to be counted before another worker can pick it up
+	s.jobs.Add(1)
+	if !s.pages.push(s.pageKey(u), u, depth) {
+		s.jobs.Done()
+	}
+}
+
+func (s *Scraper) pageWorker(ctx context.Context) {
+	for {
+		page, ok := s.pages.pop()
+		if !ok {
+			return
+		}
+		s.processPage(ctx, page)
+	}
+}
+
+// processPage downloads a page that was popped from the frontier.
+func (s *Scraper) processPage(ctx context.Context, page pageJob) {
+	if ctx.Err() != nil {
+		// keep the page for the checkpoint to resume the scrape
+		s.addFailedPage(page, ctx.Err())
+	} else {
+		s.downloadPage(ctx, page.URL, page.depth)
+	}
+	s.pages.done(page)
+	s.jobs.Done()
+}
+
+func (s *Scraper) downloadPage(ctx context.Context, u *url.URL, currentDepth uint) {
 	s.log.Info("Downloading", zap.Stringer("URL", u))
-	if err := s.browser.Open(u.String()); err != nil {
+
+	// only send a conditional request if the page still exists,
+	// validators are stored by the requested URL
+	requested := u.String()
+	var cached *validator
+	if v := s.validators.get(requested); v != nil && s.fileExists(s.storageName(u, !s.isDownloadLink(u))) {
+		cached = v
+	}
+
+	var resp *Response
+	err := s.retry(ctx, u, func() error {
+		var err error
+		resp, err = s.fetch(ctx, u, cached, 0)
+		return err
+	})
+	notModified := isNotModified(err)
+	if err != nil && !notModified {
+		if errors.Is(err, errRequestSkipped) {
+			return
+		}
+		if ctx.Err() != nil {
+			s.addFailedPage(pageJob{URL: u, depth: currentDepth}, ctx.Err())
+			return
+		}
 		s.log.Error("Request failed",
 			zap.Stringer("URL", u),
 			zap.Error(err))
+		s.recordError(u, err)
+		s.addFailedPage(pageJob{URL: u, depth: currentDepth}, err)
 		return
 	}
-	if c := s.browser.StatusCode(); c != http.StatusOK {
-		s.log.Error("Request failed",
-			zap.Stringer("URL", u),
-			zap.Int("http_status_code", c))
+
+	if currentDepth == 0 && s.pageKey(u) == s.pageKey(s.URL) {
+		// use the URL that the website returned as new base url for the
+		// scrape, in case of a redirect it changed. It can only change
+		// before the workers run, a start page that gets retried or
+		// resumed keeps the URL of the scrape.
+		if !s.running {
+			s.URL = resp.URL
+		}
+
+		if s.config.Sitemaps {
+			s.queueSitemapPages(ctx)
+		}
+	}
+
+	if notModified {
+		s.log.Debug("Page was not modified", zap.Stringer("URL", u))
+		s.onSkip(u, SkipNotModified)
+		s.queueStoredReferences(ctx, cached, currentDepth)
 		return
 	}
 
-	buf := &bytes.Buffer{}
-	if _, err := s.browser.Download(buf); err != nil {
-		s.log.Error("Downloading content failed",
+	// store the page at the path of the URL that it was redirected to
+	u = resp.URL
+	isPage, ext := contentFileType(resp.Header.Get("Content-Type"), resp.Body)
+	target := u
+	if !isPage {
+		target = s.downloadURL(u, ext)
+	}
+	s.handleRedirects(resp, target, isPage, currentDepth)
+	if u.Host != s.URL.Host {
+		return // redirected to an external page
+	}
+	s.pages.markDiscovered(s.pageKey(u), currentDepth)
+
+	if !isPage {
+		s.storeDownload(u, target, bytes.NewBuffer(resp.Body))
+		s.validators.set(requested, newValidator(resp.Header))
+		return
+	}
+
+	s.storePage(u, bytes.NewBuffer(resp.Body))
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
+	if err != nil {
+		s.log.Error("Parsing HTML failed",
 			zap.Stringer("URL", u),
 			zap.Error(err))
+		s.recordError(u, err)
 		return
 	}
+	// make the references of the page independent of a base element
+	// before discovering them
+	base := resolveBaseHref(doc.Selection, u)
+	assets := s.downloadReferences(doc.Selection, base)
 
-	if currentDepth == 0 {
-		u = s.browser.Url()
-		// use the URL that the website returned as new base url for the
-		// scrape, in case of a redirect it changed
-		s.URL = u
-	}
+	pageURLs := elementReferences(doc.Selection, u, "a[href]", "href")
+	// iframes and meta refresh targets are downloaded as pages
+	pageURLs = append(pageURLs, elementReferences(doc.Selection, u, "iframe[src]", "src")...)
+	pageURLs = append(pageURLs, metaRefreshTargets(doc.Selection, u)...)
 
-	s.storePage(u, buf)
+	var links []string
+	for _, link := range pageURLs {
+		if link.Host == s.URL.Host {
+			links = append(links, link.String())
+		}
+		if s.checkPageURL(ctx, link, currentDepth+1) {
+			s.queuePage(link, currentDepth+1)
+		}
+	}
 
-	s.downloadReferences()
+	if v := newValidator(resp.Header); v != nil {
+		v.Links = links
+		v.Assets = assets
+		s.validators.set(requested, v)
+	}
+}
 
-	var toScrape []*url.URL
-	// check first and download afterwards to not hit max depth limit for
-	// start page links because of recursive linking
-	for _, link := range s.browser.Links() {
-		if s.checkPageURL(link.URL, currentDepth) {
-			toScrape = append(toScrape, link.URL)
+// queueStoredReferences queues the links and assets of a page that was not
+// modified since the last scrape.
+func (s *Scraper) queueStoredReferences(ctx context.Context, v *validator, currentDepth uint) {
+	s.queueStoredAssets(v.Assets)
+	for _, link := range v.Links {
+		u, err := url.Parse(link)
+		if err == nil && s.checkPageURL(ctx, u, currentDepth+1) {
+			s.queuePage(u, currentDepth+1)
 		}
 	}
+}
 
-	for _, URL := range toScrape {
-		s.downloadPage(URL, currentDepth+1)
+// queueStoredAssets queues the assets that the validator of an unmodified
+// page or stylesheet references.
+func (s *Scraper) queueStoredAssets(assets []storedAsset) {
+	for _, asset := range assets {
+		u, err := url.Parse(asset.URL)
+		if err == nil {
+			s.queueAsset(u, asset.Kind)
+		}
 	}
 }
 
 func (s *Scraper) storePage(u *url.URL, buf *bytes.Buffer) {
-	html, err := s.fixFileReferences(u, buf)
+	buf, err := s.process(ContentHTML, u, buf)
 	if err != nil {
-		s.log.Error("Fixing file references failed",
+		s.log.Error("Processing page failed",
 			zap.Stringer("URL", u),
 			zap.Error(err))
-	} else {
-		buf = bytes.NewBufferString(html)
-		filePath := s.GetFilePath(u, true)
-		// always update html files, content might have changed
-		if err = s.writeFile(filePath, buf); err != nil {
-			s.log.Error("Writing HTML to file failed",
-				zap.Stringer("URL", u),
-				zap.String("file", filePath),
-				zap.Error(err))
-		}
+		s.recordError(u, err)
+		return
+	}
+
+	filePath := s.storageName(u, true)
+	// always update html files, content might have changed
+	if err = s.writeFile(filePath, buf); err != nil {
+		s.log.Error("Writing HTML to file failed",
+			zap.Stringer("URL", u),
+			zap.String("file", filePath),
+			zap.Error(err))
+		s.recordError(u, err)
+		return
 	}
+	s.onPageStored(u, filePath)
 }
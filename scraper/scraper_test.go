@@ -0,0 +1,229 @@
+package scraper
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// testSite maps URL paths to the content that the test server returns.
+type testSite map[string]string
+
+func (site testSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	content, ok := site[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if filepath.Ext(r.URL.Path) == ".css" {
+		w.Header().Set("Content-Type", "text/css")
+	}
+	_, _ = w.Write([]byte(content))
+}
+
+// scrapeTestSite scrapes the given site into the output directory and
+// returns the directory that contains the mirrored files of the site host.
+func scrapeTestSite(t *testing.T, site http.Handler, cfg Config, output string) string {
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	return scrapeTestURL(t, server.URL, cfg, output)
+}
+
+// scrapeTestURL scrapes the given URL into the output directory and
+// returns the directory that contains the mirrored files of the URL host.
+func scrapeTestURL(t *testing.T, URL string, cfg Config, output string) string {
+	dir, err := startTestScrape(t, URL, cfg, output)
+	if err != nil {
+		t.Fatalf("Scraping failed: %v", err)
+	}
+	return dir
+}
+
+// scrapeFailingTestSite scrapes a site that contains failing URLs and
+// returns the directory of the host and the error of the scrape.
+func scrapeFailingTestSite(t *testing.T, site http.Handler, cfg Config, output string) (string, error) {
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	return startTestScrape(t, server.URL, cfg, output)
+}
+
+func startTestScrape(t *testing.T, URL string, cfg Config, output string) (string, error) {
+	cfg.URL = URL
+	cfg.OutputDirectory = output
+	s, err := New(zaptest.NewLogger(t), cfg)
+	if err != nil {
+		t.Fatalf("Scraper New failed: %v", err)
+	}
+	err = s.Start()
+	return filepath.Join(output, s.hostDirectory()), err
+}
+
+// assertStored checks that the slash separated files were stored in the
+// directory.
+func assertStored(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file))); err != nil {
+			t.Errorf("File %s was not stored: %v", file, err)
+		}
+	}
+}
+
+// assertNotStored checks that the slash separated files were not stored in
+// the directory.
+func assertNotStored(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(file))); err == nil {
+			t.Errorf("File %s should not have been stored", file)
+		}
+	}
+}
+
+// assertContains checks that the file contains all references.
+func assertContains(t *testing.T, file string, refs ...string) {
+	t.Helper()
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Errorf("Reading file %s failed: %v", file, err)
+		return
+	}
+	for _, ref := range refs {
+		if !strings.Contains(string(data), ref) {
+			t.Errorf("File %s does not contain %s:\n%s", filepath.Base(file), ref, data)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "goscrape")
+	if err != nil {
+		t.Fatalf("Creating temp dir failed: %v", err)
+	}
+	return dir
+}
+
+func TestStartConcurrent(t *testing.T) {
+	site := testSite{
+		"/": `<html><head><link rel="stylesheet" href="style.css"></head><body>
+			<a href="a/">a</a><a href="b">b</a><a href="c.html">c</a></body></html>`,
+		"/a/":         `<html><body><a href="../b">b</a><a href="d">d</a><img src="/img/x.png"></body></html>`,
+		"/a/d":        `<html><body><a href="/">home</a></body></html>`,
+		"/b":          `<html><body><script src="js/app.js"></script></body></html>`,
+		"/c.html":     `<html><body>c</body></html>`,
+		"/style.css":  `body { background: url(img/bg.png); }`,
+		"/img/x.png":  "x",
+		"/img/bg.png": "bg",
+		"/js/app.js":  "app",
+	}
+	cfg := Config{
+		Concurrency:      4,
+		AssetConcurrency: 4,
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, cfg, output)
+
+	assertStored(t, dir,
+		"index.html",
+		"a/index.html",
+		"a/d.html",
+		"b.html",
+		"c.html",
+		"style.css",
+		"img/x.png",
+		"img/bg.png",
+		"js/app.js",
+	)
+}
+
+func TestRequestHeaders(t *testing.T) {
+	site := testSite{
+		"/":       `<html><body><script src="app.js"></script></body></html>`,
+		"/app.js": "app",
+	}
+
+	var mu sync.Mutex
+	headers := make(map[string]http.Header)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.URL.Path] = r.Header
+		mu.Unlock()
+		site.ServeHTTP(w, r)
+	})
+
+	cfg := Config{
+		UserAgent: "testbot/1.0",
+		Headers: http.Header{
+			"X-Token": []string{"secret"},
+		},
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	scrapeTestSite(t, handler, cfg, output)
+
+	for _, path := range []string{"/robots.txt", "/", "/app.js"} {
+		h, ok := headers[path]
+		if !ok {
+			t.Errorf("No request for %s was sent", path)
+			continue
+		}
+		if ua := h.Get("User-Agent"); ua != cfg.UserAgent {
+			t.Errorf("Request for %s had user agent %s", path, ua)
+		}
+		if token := h.Get("X-Token"); token != "secret" {
+			t.Errorf("Request for %s had header X-Token %s", path, token)
+		}
+	}
+}
+
+func TestScrapeMedia(t *testing.T) {
+	site := testSite{
+		"/": `<html><body>
+			<video src="media/clip.mp4" poster="media/poster.png">
+			<track src="media/subs.vtt" kind="subtitles"></video>
+			<video><source src="media/large.webm" type="video/webm"></video>
+			<audio src="media/sound.mp3"></audio>
+			<embed src="media/anim.swf"><object data="media/doc.pdf"></object>
+			<iframe src="frame.html"></iframe><iframe src="about:blank"></iframe>
+			</body></html>`,
+		"/frame.html":       `<html><body><img src="media/framed.png"></body></html>`,
+		"/media/clip.mp4":   "clip",
+		"/media/poster.png": "poster",
+		"/media/subs.vtt":   "subs",
+		"/media/large.webm": "larger than the limit",
+		"/media/sound.mp3":  "sound",
+		"/media/anim.swf":   "anim",
+		"/media/doc.pdf":    "doc",
+		"/media/framed.png": "framed",
+	}
+	cfg := Config{
+		MaxMediaSize: 10,
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, cfg, output)
+
+	assertStored(t, dir,
+		"frame.html",
+		"media/clip.mp4",
+		"media/poster.png",
+		"media/subs.vtt",
+		"media/sound.mp3",
+		"media/anim.swf",
+		"media/doc.pdf",
+		"media/framed.png",
+	)
+	// the media file is larger than the size limit
+	assertNotStored(t, dir, "media/large.webm")
+	assertContains(t, filepath.Join(dir, "index.html"), `src="about:blank"`, `src="frame.html"`, `data="media/doc.pdf"`)
+}
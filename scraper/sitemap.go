@@ -0,0 +1,125 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxSitemapDepth is the max nesting level of sitemap indexes.
+const maxSitemapDepth = 3
+
+// sitemapLocations contains the locations of a sitemap or a sitemap index.
+type sitemapLocations struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// parseSitemap parses a sitemap or sitemap index, which can be gzip
+// compressed, and returns the page URLs and nested sitemap URLs.
+func parseSitemap(data []byte) (pages []string, sitemaps []string, err error) {
+	var r io.Reader = bytes.NewReader(data)
+	if len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var locations sitemapLocations
+	if err = xml.NewDecoder(r).Decode(&locations); err != nil {
+		return nil, nil, err
+	}
+
+	for _, u := range locations.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			pages = append(pages, loc)
+		}
+	}
+	for _, sitemap := range locations.Sitemaps {
+		if loc := strings.TrimSpace(sitemap.Loc); loc != "" {
+			sitemaps = append(sitemaps, loc)
+		}
+	}
+	return pages, sitemaps, nil
+}
+
+// queueSitemapPages downloads the /sitemap.xml file of the website and all
+// sitemaps listed in its robots.txt file and queues all contained pages as
+// depth 0 pages.
+func (s *Scraper) queueSitemapPages(ctx context.Context) {
+	root := &url.URL{Scheme: s.URL.Scheme, Host: s.URL.Host, Path: "/"}
+	sitemaps := []string{"/sitemap.xml"}
+	if s.robots != nil {
+		sitemaps = append(sitemaps, s.robots.sitemaps(ctx, s.URL)...)
+	}
+
+	visited := make(map[string]struct{})
+	for _, sitemap := range sitemaps {
+		s.downloadSitemap(ctx, root, sitemap, 0, visited)
+	}
+}
+
+// downloadSitemap downloads a sitemap, the location can be relative to the
+// base URL.
+func (s *Scraper) downloadSitemap(ctx context.Context, base *url.URL, location string, level int, visited map[string]struct{}) {
+	ref, err := url.Parse(location)
+	if err != nil {
+		s.log.Error("Parsing sitemap URL failed", zap.String("URL", location), zap.Error(err))
+		return
+	}
+	u := base.ResolveReference(ref)
+
+	if _, ok := visited[u.String()]; ok {
+		return
+	}
+	visited[u.String()] = struct{}{}
+
+	s.log.Info("Downloading sitemap", zap.Stringer("URL", u))
+	var resp *Response
+	err = s.retry(ctx, u, func() error {
+		var err error
+		resp, err = s.fetch(ctx, u, nil, 0)
+		return err
+	})
+	if err != nil {
+		s.log.Debug("Downloading sitemap failed", zap.Stringer("URL", u), zap.Error(err))
+		return
+	}
+
+	pages, sitemaps, err := parseSitemap(resp.Body)
+	if err != nil {
+		s.log.Error("Parsing sitemap failed", zap.Stringer("URL", u), zap.Error(err))
+		return
+	}
+
+	for _, page := range pages {
+		ref, err := url.Parse(page)
+		if err != nil {
+			continue
+		}
+		pageURL := u.ResolveReference(ref)
+		if s.checkPageURL(ctx, pageURL, 0) {
+			s.queuePage(pageURL, 0)
+		}
+	}
+
+	if level >= maxSitemapDepth {
+		return
+	}
+	for _, nested := range sitemaps {
+		s.downloadSitemap(ctx, u, nested, level+1, visited)
+	}
+}
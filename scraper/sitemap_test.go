@@ -0,0 +1,69 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"testing"
+)
+
+func gzipString(t *testing.T, s string) string {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write([]byte(s)); err != nil {
+		t.Fatalf("Compressing failed: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("Compressing failed: %v", err)
+	}
+	return buf.String()
+}
+
+func TestParseSitemap(t *testing.T) {
+	index := `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap1.xml.gz</loc></sitemap>
+</sitemapindex>`
+
+	pages, sitemaps, err := parseSitemap([]byte(index))
+	if err != nil {
+		t.Fatalf("Parsing sitemap index failed: %v", err)
+	}
+	if len(pages) != 0 || len(sitemaps) != 1 || sitemaps[0] != "https://example.com/sitemap1.xml.gz" {
+		t.Errorf("Unexpected sitemap index result %v %v", pages, sitemaps)
+	}
+
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc> https://example.com/a </loc><lastmod>2020-01-01</lastmod></url>
+  <url><loc>https://example.com/b</loc></url>
+</urlset>`
+
+	pages, sitemaps, err = parseSitemap([]byte(gzipString(t, urlset)))
+	if err != nil {
+		t.Fatalf("Parsing gzipped sitemap failed: %v", err)
+	}
+	if len(sitemaps) != 0 || len(pages) != 2 || pages[0] != "https://example.com/a" || pages[1] != "https://example.com/b" {
+		t.Errorf("Unexpected sitemap result %v %v", pages, sitemaps)
+	}
+}
+
+func TestSitemapPages(t *testing.T) {
+	site := testSite{
+		"/robots.txt": "Sitemap: /sitemaps/index.xml\n",
+		"/":           `<html><body>no links</body></html>`,
+		"/sitemap.xml": `<urlset><url><loc>/orphan</loc></url>
+			<url><loc>http://external.example.com/page</loc></url></urlset>`,
+		"/sitemaps/index.xml": `<sitemapindex><sitemap><loc>/sitemaps/pages.xml.gz</loc></sitemap></sitemapindex>`,
+		"/orphan":             `<html><body>orphan</body></html>`,
+		"/nested":             `<html><body><a href="linked">linked</a></body></html>`,
+		"/linked":             `<html><body>linked</body></html>`,
+	}
+	site["/sitemaps/pages.xml.gz"] = gzipString(t, `<urlset><url><loc>/nested</loc></url></urlset>`)
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, Config{Sitemaps: true}, output)
+
+	assertStored(t, dir, "index.html", "orphan.html", "nested.html", "linked.html")
+}
@@ -0,0 +1,74 @@
+package scraper
+
+import (
+	"strings"
+	"unicode"
+)
+
+// srcsetCandidate is an image candidate of a srcset attribute.
+type srcsetCandidate struct {
+	URL        string
+	Descriptor string // width or density descriptor like 100w or 2x, can be empty
+}
+
+// parseSrcset parses the value of a srcset attribute into its image
+// candidates.
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	s := srcset
+
+	for {
+		// skip whitespace and commas before the URL
+		s = strings.TrimLeftFunc(s, func(r rune) bool {
+			return unicode.IsSpace(r) || r == ','
+		})
+		if s == "" {
+			return candidates
+		}
+
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end == -1 {
+			end = len(s)
+		}
+		u := s[:end]
+		s = s[end:]
+
+		// a URL that ends with commas has no descriptors
+		if strings.HasSuffix(u, ",") {
+			candidates = append(candidates, srcsetCandidate{URL: strings.TrimRight(u, ",")})
+			continue
+		}
+
+		// descriptors end at the next comma that is not inside parentheses
+		depth := 0
+		end = len(s)
+		for i, r := range s {
+			if r == '(' {
+				depth++
+			} else if r == ')' && depth > 0 {
+				depth--
+			} else if r == ',' && depth == 0 {
+				end = i
+				break
+			}
+		}
+		candidates = append(candidates, srcsetCandidate{
+			URL:        u,
+			Descriptor: strings.TrimSpace(s[:end]),
+		})
+		s = s[end:]
+	}
+}
+
+// formatSrcset returns the srcset attribute value of the candidates.
+func formatSrcset(candidates []srcsetCandidate) string {
+	parts := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if c.Descriptor == "" {
+			parts = append(parts, c.URL)
+		} else {
+			parts = append(parts, c.URL+" "+c.Descriptor)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
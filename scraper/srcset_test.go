@@ -0,0 +1,71 @@
+package scraper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseSrcset(t *testing.T) {
+	var fixtures = map[string][]srcsetCandidate{
+		"image.png": {
+			{URL: "image.png"},
+		},
+		"small.jpg 480w, large.jpg 1080w": {
+			{URL: "small.jpg", Descriptor: "480w"},
+			{URL: "large.jpg", Descriptor: "1080w"},
+		},
+		"  a.png, b.png 2x ,\n c.png  1.5x  ": {
+			{URL: "a.png"},
+			{URL: "b.png", Descriptor: "2x"},
+			{URL: "c.png", Descriptor: "1.5x"},
+		},
+		"/img,with,commas.png 1x, data:image/gif;base64,R0lGODl 2x": {
+			{URL: "/img,with,commas.png", Descriptor: "1x"},
+			{URL: "data:image/gif;base64,R0lGODl", Descriptor: "2x"},
+		},
+		"": nil,
+	}
+
+	for input, expected := range fixtures {
+		candidates := parseSrcset(input)
+		if !reflect.DeepEqual(candidates, expected) {
+			t.Errorf("Srcset %q should have been parsed to %v but was %v", input, expected, candidates)
+		}
+	}
+}
+
+func TestFormatSrcset(t *testing.T) {
+	candidates := []srcsetCandidate{
+		{URL: "small.jpg", Descriptor: "480w"},
+		{URL: "large.jpg"},
+	}
+	expected := "small.jpg 480w, large.jpg"
+	if srcset := formatSrcset(candidates); srcset != expected {
+		t.Errorf("Srcset should have been %s but was %s", expected, srcset)
+	}
+}
+
+func TestScrapeSrcset(t *testing.T) {
+	site := testSite{
+		"/a/": `<html><body><picture>
+			<source srcset="/img/wide.png 1200w, /img/huge.png 2400w" media="(min-width: 800px)">
+			<img src="small.png" srcset="small.png, medium.png 2x, data:image/gif;base64,R0lGODl 3x">
+			</picture></body></html>`,
+		"/":             `<html><body><a href="a/">a</a></body></html>`,
+		"/img/wide.png": "wide",
+		"/img/huge.png": "huge",
+		"/a/small.png":  "small",
+		"/a/medium.png": "medium",
+	}
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	dir := scrapeTestSite(t, site, Config{}, output)
+
+	assertStored(t, dir, "img/wide.png", "img/huge.png", "a/small.png", "a/medium.png")
+	assertContains(t, filepath.Join(dir, "a", "index.html"),
+		`srcset="../img/wide.png 1200w, ../img/huge.png 2400w"`,
+		`srcset="small.png, medium.png 2x, data:image/gif;base64,R0lGODl 3x"`,
+	)
+}
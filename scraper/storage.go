@@ -0,0 +1,378 @@
+package scraper
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Storage stores the files of the mirror. File names are slash separated
+// paths relative to the root of the mirror. Read returns an error that
+// satisfies os.IsNotExist for files that do not exist.
+// The methods are called concurrently by the page and asset workers.
+type Storage interface {
+	Exists(name string) (bool, error)
+	// Write replaces the content of the file, readers never see a
+	// partially written file.
+	Write(name string, data []byte) error
+	Read(name string) ([]byte, error)
+	Remove(name string) error
+	// List returns the sorted names of all files below the directory,
+	// an empty directory lists all files.
+	List(dir string) ([]string, error)
+}
+
+// linker is implemented by storages that support hardlinks.
+type linker interface {
+	Link(oldName, newName string) error
+}
+
+// LocalStorage stores the files in a directory of the local file system.
+type LocalStorage struct {
+	dir string
+}
+
+// NewLocalStorage returns a storage for the given directory, an empty
+// directory is the current working directory.
+func NewLocalStorage(dir string) *LocalStorage {
+	return &LocalStorage{
+		dir: dir,
+	}
+}
+
+func (l *LocalStorage) path(name string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(name))
+}
+
+// Exists implements the Storage interface.
+func (l *LocalStorage) Exists(name string) (bool, error) {
+	_, err := os.Stat(l.path(name))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// Write implements the Storage interface. The content is written to a temp
+// file that is renamed to the file name, this also replaces a hardlink
+// instead of writing through it.
+func (l *LocalStorage) Write(name string, data []byte) error {
+	filePath := l.path(name)
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Chmod(0644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filePath)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name()) // do not leave incomplete temp files behind
+	}
+	return err
+}
+
+// Read implements the Storage interface.
+func (l *LocalStorage) Read(name string) ([]byte, error) {
+	return ioutil.ReadFile(l.path(name))
+}
+
+// Remove implements the Storage interface, removing a file that does not
+// exist is not an error.
+func (l *LocalStorage) Remove(name string) error {
+	err := os.Remove(l.path(name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List implements the Storage interface.
+func (l *LocalStorage) List(dir string) ([]string, error) {
+	var names []string
+	err := filepath.Walk(l.path(dir), func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.path(""), filePath)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// Link creates the file newName as a hardlink to the file oldName.
+func (l *LocalStorage) Link(oldName, newName string) error {
+	newPath := l.path(newName)
+	if err := os.MkdirAll(filepath.Dir(newPath), os.ModePerm); err != nil {
+		return err
+	}
+	if err := l.Remove(newName); err != nil {
+		return err
+	}
+	return os.Link(l.path(oldName), newPath)
+}
+
+// MemoryStorage stores the files in memory.
+// It is safe for concurrent use.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	files map[string][]byte
+}
+
+// NewMemoryStorage returns an empty memory storage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		files: make(map[string][]byte),
+	}
+}
+
+// Exists implements the Storage interface.
+func (m *MemoryStorage) Exists(name string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.files[path.Clean(name)]
+	return ok, nil
+}
+
+// Write implements the Storage interface.
+func (m *MemoryStorage) Write(name string, data []byte) error {
+	b := make([]byte, len(data))
+	copy(b, data)
+
+	m.mu.Lock()
+	m.files[path.Clean(name)] = b
+	m.mu.Unlock()
+	return nil
+}
+
+// Read implements the Storage interface.
+func (m *MemoryStorage) Read(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	b, ok := m.files[path.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "read", Path: name, Err: os.ErrNotExist}
+	}
+	data := make([]byte, len(b))
+	copy(data, b)
+	return data, nil
+}
+
+// Remove implements the Storage interface.
+func (m *MemoryStorage) Remove(name string) error {
+	m.mu.Lock()
+	delete(m.files, path.Clean(name))
+	m.mu.Unlock()
+	return nil
+}
+
+// List implements the Storage interface.
+func (m *MemoryStorage) List(dir string) ([]string, error) {
+	prefix := ""
+	if dir = path.Clean(dir); dir != "." && dir != "" {
+		prefix = dir + "/"
+	}
+
+	m.mu.RLock()
+	var names []string
+	for name := range m.files {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// ArchiveStorage stores the files in a zip archive. The files are staged in
+// a temp directory while scraping and the archive is written on Close.
+// The files of an existing archive are restored, which allows updating and
+// resuming a scrape into the same archive.
+// Zip archives can not contain hardlinks, the storage does not support
+// deduplication.
+type ArchiveStorage struct {
+	staging     *LocalStorage
+	archivePath string
+}
+
+// NewArchiveStorage returns a storage that writes a zip archive to the given
+// path when it gets closed.
+func NewArchiveStorage(archivePath string) (*ArchiveStorage, error) {
+	dir, err := ioutil.TempDir("", "goscrape-archive")
+	if err != nil {
+		return nil, err
+	}
+	a := &ArchiveStorage{
+		staging:     NewLocalStorage(dir),
+		archivePath: archivePath,
+	}
+	if err = a.extract(); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return a, nil
+}
+
+// Exists implements the Storage interface.
+func (a *ArchiveStorage) Exists(name string) (bool, error) {
+	return a.staging.Exists(name)
+}
+
+// Write implements the Storage interface.
+func (a *ArchiveStorage) Write(name string, data []byte) error {
+	return a.staging.Write(name, data)
+}
+
+// Read implements the Storage interface.
+func (a *ArchiveStorage) Read(name string) ([]byte, error) {
+	return a.staging.Read(name)
+}
+
+// Remove implements the Storage interface.
+func (a *ArchiveStorage) Remove(name string) error {
+	return a.staging.Remove(name)
+}
+
+// List implements the Storage interface.
+func (a *ArchiveStorage) List(dir string) ([]string, error) {
+	return a.staging.List(dir)
+}
+
+// extract copies the files of an existing archive into the staging
+// directory.
+func (a *ArchiveStorage) extract() error {
+	r, err := zip.OpenReader(a.archivePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer r.Close()
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		data, err := readZipFile(f)
+		if err != nil {
+			return err
+		}
+		// archives can contain paths that leave the staging directory,
+		// cleaning the name as an absolute path confines it
+		name := strings.TrimPrefix(path.Clean("/"+f.Name), "/")
+		if err = a.Write(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// Close writes all files to the archive and removes the staging directory.
+// The archive is written to a temp file first to keep an existing archive
+// intact if writing fails.
+func (a *ArchiveStorage) Close() error {
+	names, err := a.List("")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := a.archivePath + ".tmp"
+	if err = a.writeArchive(tmpPath, names); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	if err = os.Rename(tmpPath, a.archivePath); err != nil {
+		return err
+	}
+	return os.RemoveAll(a.staging.dir)
+}
+
+func (a *ArchiveStorage) writeArchive(filePath string, names []string) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	w := zip.NewWriter(f)
+	for _, name := range names {
+		if err = a.addFile(w, name); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+	if err = w.Close(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (a *ArchiveStorage) addFile(w *zip.Writer, name string) error {
+	src, err := os.Open(a.staging.path(name))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	dst, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	return err
+}
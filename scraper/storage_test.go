@@ -0,0 +1,157 @@
+package scraper
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testStorage(t *testing.T, name string, storage Storage) {
+	files := map[string]string{
+		"index.html":   "index",
+		"a/b.css":      "css",
+		"a/c/d.png":    "image",
+		".hidden.json": "{}",
+	}
+	for file, content := range files {
+		if err := storage.Write(file, []byte(content)); err != nil {
+			t.Fatalf("%s: writing %s failed: %v", name, file, err)
+		}
+	}
+	if err := storage.Write("a/b.css", []byte("replaced")); err != nil {
+		t.Fatalf("%s: replacing file failed: %v", name, err)
+	}
+
+	data, err := storage.Read("a/b.css")
+	if err != nil {
+		t.Fatalf("%s: reading file failed: %v", name, err)
+	}
+	if string(data) != "replaced" {
+		t.Errorf("%s: file content should be %q but was %q", name, "replaced", data)
+	}
+	if _, err = storage.Read("missing"); !os.IsNotExist(err) {
+		t.Errorf("%s: reading a missing file should return a not exist error but got %v", name, err)
+	}
+
+	if exists, err := storage.Exists("a/c/d.png"); err != nil || !exists {
+		t.Errorf("%s: existing file was not found: %v", name, err)
+	}
+	if exists, err := storage.Exists("a/missing.png"); err != nil || exists {
+		t.Errorf("%s: missing file was found: %v", name, err)
+	}
+
+	names, err := storage.List("a")
+	if err != nil {
+		t.Fatalf("%s: listing files failed: %v", name, err)
+	}
+	if expected := []string{"a/b.css", "a/c/d.png"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("%s: listed files should be %v but were %v", name, expected, names)
+	}
+
+	if err = storage.Remove("index.html"); err != nil {
+		t.Fatalf("%s: removing file failed: %v", name, err)
+	}
+	if err = storage.Remove("index.html"); err != nil {
+		t.Errorf("%s: removing a missing file failed: %v", name, err)
+	}
+	names, err = storage.List("")
+	if err != nil {
+		t.Fatalf("%s: listing files failed: %v", name, err)
+	}
+	if expected := []string{".hidden.json", "a/b.css", "a/c/d.png"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("%s: listed files should be %v but were %v", name, expected, names)
+	}
+}
+
+func TestStorages(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	testStorage(t, "local", NewLocalStorage(dir))
+	testStorage(t, "memory", NewMemoryStorage())
+}
+
+func TestScrapeMemoryStorage(t *testing.T) {
+	site := testSite{
+		"/":        `<html><body><a href="a">a</a><img src="x.png"></body></html>`,
+		"/a":       `<html><body>a</body></html>`,
+		"/x.png":   "image",
+		"/unknown": "unknown",
+	}
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+
+	storage := NewMemoryStorage()
+	dir := scrapeTestSite(t, site, Config{Storage: storage}, output)
+	host := filepath.Base(dir)
+
+	names, err := storage.List(host)
+	if err != nil {
+		t.Fatalf("Listing files failed: %v", err)
+	}
+	expected := []string{host + "/" + PathsFile, host + "/a.html", host + "/index.html", host + "/x.png"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Stored files should be %v but were %v", expected, names)
+	}
+	if exists, _ := storage.Exists(ValidatorsFile); !exists {
+		t.Error("Validators were not stored")
+	}
+
+	files, err := filepath.Glob(filepath.Join(output, "*"))
+	if err != nil {
+		t.Fatalf("Listing output directory failed: %v", err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Files were written to the output directory: %v", files)
+	}
+}
+
+func TestArchiveStorage(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	archivePath := filepath.Join(dir, "mirror.zip")
+
+	storage, err := NewArchiveStorage(archivePath)
+	if err != nil {
+		t.Fatalf("Creating archive storage failed: %v", err)
+	}
+	testStorage(t, "archive", storage)
+	// zip archives can not contain hardlinks, deduplicated files would be
+	// stored twice
+	if _, ok := Storage(storage).(linker); ok {
+		t.Error("Archive storage should not support hardlinks")
+	}
+	if err = storage.Close(); err != nil {
+		t.Fatalf("Closing archive storage failed: %v", err)
+	}
+
+	r, err := zip.OpenReader(archivePath)
+	if err != nil {
+		t.Fatalf("Opening archive failed: %v", err)
+	}
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	_ = r.Close()
+	if expected := []string{".hidden.json", "a/b.css", "a/c/d.png"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("Archived files should be %v but were %v", expected, names)
+	}
+
+	// reopening the archive restores the files
+	storage, err = NewArchiveStorage(archivePath)
+	if err != nil {
+		t.Fatalf("Reopening archive storage failed: %v", err)
+	}
+	defer storage.Close()
+	data, err := storage.Read("a/c/d.png")
+	if err != nil {
+		t.Fatalf("Reading restored file failed: %v", err)
+	}
+	if string(data) != "image" {
+		t.Errorf("Restored file content should be %q but was %q", "image", data)
+	}
+}
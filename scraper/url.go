@@ -3,7 +3,6 @@ package scraper
 import (
 	"net/url"
 	"path"
-	"path/filepath"
 	"strings"
 )
 
@@ -33,18 +32,28 @@ func (s *Scraper) resolveURL(base *url.URL, reference string, linkIsAPage bool,
 		}
 
 		resolvedURL = base.ResolveReference(ur)
-		resolvedURL.Path = filepath.Join("_"+ur.Host, resolvedURL.Path)
+		resolvedURL.Path = path.Join("_"+ur.Host, sanitizePath(resolvedURL.Path))
 	} else {
+		// query only and empty references get the path of the base
+		resolvedURL = base.ResolveReference(ur)
 		if linkIsAPage {
-			ur.Path = GetPageFilePath(ur)
-			resolvedURL = base.ResolveReference(ur)
-		} else {
-			resolvedURL = base.ResolveReference(ur)
+			resolvedURL.Path = GetPageFilePath(resolvedURL)
 		}
 	}
 
+	if suffix := s.querySuffix(resolvedURL); suffix != "" {
+		// the query is part of the file name
+		resolvedURL.Path = addFileSuffix(resolvedURL.Path, suffix)
+		resolvedURL.RawQuery = ""
+	}
+	resolvedURL.Path = "/" + s.paths.localPath(resolvedURL.Path)
+
 	if resolvedURL.Host == s.URL.Host {
+		filePath := resolvedURL.Path
 		resolvedURL.Path = urlRelativeToOther(resolvedURL, base)
+		if resolvedURL.Path == "" && resolvedURL.Fragment == "" {
+			resolvedURL.Path = path.Base(filePath) // link to the page itself
+		}
 		relativeToRoot = ""
 	}
 
@@ -89,8 +98,8 @@ func (s *Scraper) urlRelativeToRoot(url *url.URL) string {
 }
 
 func urlRelativeToOther(src, base *url.URL) string {
-	srcSplits := strings.Split(src.Path, "/")
-	baseSplits := strings.Split(GetPageFilePath(base), "/")
+	srcSplits := strings.Split(sanitizePath(src.Path), "/")
+	baseSplits := strings.Split(sanitizePath(GetPageFilePath(base)), "/")
 
 	for {
 		if len(srcSplits) == 0 || len(baseSplits) == 0 {
@@ -38,12 +38,21 @@ func Test_resolveURL(t *testing.T) {
 		Path:   "/earth/",
 	}
 
+	listURL := url.URL{
+		Scheme: "https",
+		Host:   "petpic.xyz",
+		Path:   "/earth/list",
+	}
+
 	var fixtures = []filePathFixture{
 		{pathlessURL, "", true, "", "index.html"},
 		{pathlessURL, "#contents", true, "", "#contents"},
 		{URL, "brasil/index.html", true, "", "brasil/index.html"},
 		{URL, "brasil/rio/index.html", true, "", "brasil/rio/index.html"},
 		{URL, "../argentina/cat.jpg", false, "", "../argentina/cat.jpg"},
+		{listURL, "?page=2", true, "", "list_b941a131.html"},
+		{listURL, "", true, "", "list.html"},
+		{listURL, "#top", true, "", "#top"},
 	}
 
 	for _, fix := range fixtures {
@@ -0,0 +1,116 @@
+package scraper
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// ValidatorsFile is the file name of the response validators that get
+// stored in the output directory to send conditional requests when the
+// website gets scraped again.
+const ValidatorsFile = ".goscrape-validators.json"
+
+// validator contains the validators of a downloaded URL. For pages the
+// links and assets and for stylesheets the assets are stored as well to
+// continue the scrape if the file was not modified.
+type validator struct {
+	ETag         string        `json:"etag,omitempty"`
+	LastModified string        `json:"last_modified,omitempty"`
+	Links        []string      `json:"links,omitempty"`
+	Assets       []storedAsset `json:"assets,omitempty"`
+}
+
+// storedAsset is an asset URL with the kind of its processor.
+type storedAsset struct {
+	URL  string    `json:"url"`
+	Kind assetKind `json:"kind"`
+}
+
+// newValidator returns the validators of the response headers, it returns
+// nil if the response has no validators.
+func newValidator(header http.Header) *validator {
+	v := &validator{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	}
+	if v.ETag == "" && v.LastModified == "" {
+		return nil
+	}
+	return v
+}
+
+// setConditionalHeaders sets the headers for a conditional request.
+func (v *validator) setConditionalHeaders(header http.Header) {
+	if v.ETag != "" {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if v.LastModified != "" {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+}
+
+// validatorStore contains the validators of all downloaded URLs.
+// It is safe for concurrent use.
+type validatorStore struct {
+	mu         sync.Mutex
+	validators map[string]*validator
+}
+
+func newValidatorStore() *validatorStore {
+	return &validatorStore{
+		validators: make(map[string]*validator),
+	}
+}
+
+func (v *validatorStore) get(u string) *validator {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.validators[u]
+}
+
+// set stores the validator of the URL, a nil validator removes it.
+func (v *validatorStore) set(u string, val *validator) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if val == nil {
+		delete(v.validators, u)
+		return
+	}
+	v.validators[u] = val
+}
+
+// loadValidators loads the validators of a previous scrape.
+func (s *Scraper) loadValidators() error {
+	b, err := s.storage.Read(ValidatorsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	s.validators.mu.Lock()
+	defer s.validators.mu.Unlock()
+	return json.Unmarshal(b, &s.validators.validators)
+}
+
+// writeValidators writes the validators of all downloaded URLs.
+func (s *Scraper) writeValidators() error {
+	s.validators.mu.Lock()
+	b, err := json.Marshal(s.validators.validators)
+	s.validators.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.storage.Write(ValidatorsFile, b)
+}
+
+// isNotModified returns whether the error is a not modified response to a
+// conditional request.
+func isNotModified(err error) bool {
+	se, ok := err.(*statusError)
+	return ok && se.code == http.StatusNotModified
+}
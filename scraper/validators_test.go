@@ -0,0 +1,101 @@
+package scraper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// etagSite serves the test site with ETag headers and answers conditional
+// requests, it counts the full responses per path.
+type etagSite struct {
+	mu   sync.Mutex
+	site testSite
+	sent map[string]int
+}
+
+func (e *etagSite) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	content, ok := e.site[r.URL.Path]
+	e.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	hash := sha1.Sum([]byte(content))
+	etag := `"` + hex.EncodeToString(hash[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	e.mu.Lock()
+	e.sent[r.URL.Path]++
+	e.mu.Unlock()
+	_, _ = w.Write([]byte(content))
+}
+
+func TestConditionalRequests(t *testing.T) {
+	site := &etagSite{
+		site: testSite{
+			"/": `<html><head><link rel="stylesheet" href="style.css"></head>
+				<body><a href="page">page</a><script src="app.js"></script></body></html>`,
+			"/page": `<html><head><style>body { background: url(style.png); }</style></head>
+				<body><img src="img.png"><div style="background: url('bg.png')"></div></body></html>`,
+			"/app.js":    "app",
+			"/img.png":   "img",
+			"/bg.png":    "bg",
+			"/style.png": "style",
+			"/style.css": "body { background: url(css.png); }",
+			"/css.png":   "css",
+		},
+		sent: make(map[string]int),
+	}
+
+	server := httptest.NewServer(site)
+	defer server.Close()
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	scrapeTestURL(t, server.URL, Config{}, output)
+
+	site.mu.Lock()
+	for _, path := range []string{"/img.png", "/bg.png", "/style.png", "/css.png"} {
+		site.site[path] = "new " + path
+	}
+	site.mu.Unlock()
+	dir := scrapeTestURL(t, server.URL, Config{}, output)
+
+	// the assets of inline styles of unmodified pages and of unmodified
+	// stylesheets are checked as well
+	var expected = map[string]int{
+		"/":          1,
+		"/page":      1,
+		"/app.js":    1,
+		"/img.png":   2,
+		"/bg.png":    2,
+		"/style.png": 2,
+		"/style.css": 1,
+		"/css.png":   2,
+	}
+	for path, count := range expected {
+		if sent := site.sent[path]; sent != count {
+			t.Errorf("Path %s should have been sent %d times but was sent %d times", path, count, sent)
+		}
+	}
+
+	for _, file := range []string{"img.png", "bg.png", "style.png", "css.png"} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil || string(b) != "new /"+file {
+			t.Errorf("Modified asset %s was not updated: %s %v", file, string(b), err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package scraper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultWARCMaxSize is the size in bytes after which a new WARC file gets
+// started if no size is configured.
+const DefaultWARCMaxSize = 1 << 30
+
+// warcWriter writes the requests and responses of all downloads as gzip
+// compressed WARC/1.1 records. A new file is started once the current one
+// exceeds the max size. It is safe for concurrent use.
+type warcWriter struct {
+	prefix  string // path prefix of the files
+	maxSize int64
+	started string // start time used in the file names
+
+	mu        sync.Mutex
+	file      *os.File
+	size      int64
+	index     int
+	warcinfo  string // record ID of the warcinfo record of the current file
+	userAgent string
+}
+
+func newWARCWriter(prefix string, maxSize int64, userAgent string) *warcWriter {
+	if maxSize <= 0 {
+		maxSize = DefaultWARCMaxSize
+	}
+	return &warcWriter{
+		prefix:    prefix,
+		maxSize:   maxSize,
+		started:   time.Now().UTC().Format("20060102150405"),
+		userAgent: userAgent,
+	}
+}
+
+// writeExchange writes a request and a response record for a download. The
+// body is the unmodified content of the response.
+func (w *warcWriter) writeExchange(req *http.Request, resp *http.Response, body []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.rotate(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	target := req.URL.String()
+	responseID := newRecordID()
+	requestID := newRecordID()
+
+	block := &bytes.Buffer{}
+	writeHTTPResponseHead(block, resp, len(body))
+	block.Write(body)
+	err := w.writeRecord(map[string]string{
+		"WARC-Type":           "response",
+		"WARC-Record-ID":      responseID,
+		"WARC-Date":           formatWARCDate(now),
+		"WARC-Target-URI":     target,
+		"WARC-Warcinfo-ID":    w.warcinfo,
+		"WARC-Payload-Digest": warcDigest(body),
+		"Content-Type":        "application/http;msgtype=response",
+	}, block.Bytes())
+	if err != nil {
+		return err
+	}
+
+	block.Reset()
+	writeHTTPRequestHead(block, req)
+	return w.writeRecord(map[string]string{
+		"WARC-Type":          "request",
+		"WARC-Record-ID":     requestID,
+		"WARC-Date":          formatWARCDate(now),
+		"WARC-Target-URI":    target,
+		"WARC-Warcinfo-ID":   w.warcinfo,
+		"WARC-Concurrent-To": responseID,
+		"Content-Type":       "application/http;msgtype=request",
+	}, block.Bytes())
+}
+
+// rotate opens the first or the next file if the current file exceeds the
+// max size. The caller has to hold the lock.
+func (w *warcWriter) rotate() error {
+	if w.file != nil && w.size < w.maxSize {
+		return nil
+	}
+	if err := w.closeFile(); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, w.started, w.index)
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	w.file = f
+	w.size = 0
+	w.index++
+
+	info := fmt.Sprintf("software: goscrape\r\nformat: WARC File Format 1.1\r\nhttp-header-user-agent: %s\r\n", w.userAgent)
+	w.warcinfo = newRecordID()
+	return w.writeRecord(map[string]string{
+		"WARC-Type":      "warcinfo",
+		"WARC-Record-ID": w.warcinfo,
+		"WARC-Date":      formatWARCDate(time.Now()),
+		"WARC-Filename":  filepath.Base(fileName),
+		"Content-Type":   "application/warc-fields",
+	}, []byte(info))
+}
+
+// warcHeaderOrder is the order in which the WARC headers are written.
+var warcHeaderOrder = []string{
+	"WARC-Type",
+	"WARC-Record-ID",
+	"WARC-Date",
+	"WARC-Filename",
+	"WARC-Target-URI",
+	"WARC-Warcinfo-ID",
+	"WARC-Concurrent-To",
+	"WARC-Block-Digest",
+	"WARC-Payload-Digest",
+	"Content-Type",
+	"Content-Length",
+}
+
+// writeRecord writes a record as a separate gzip member to the current
+// file. The caller has to hold the lock.
+func (w *warcWriter) writeRecord(headers map[string]string, block []byte) error {
+	headers["WARC-Block-Digest"] = warcDigest(block)
+	headers["Content-Length"] = strconv.Itoa(len(block))
+
+	record := &bytes.Buffer{}
+	record.WriteString("WARC/1.1\r\n")
+	for _, name := range warcHeaderOrder {
+		if value := headers[name]; value != "" {
+			fmt.Fprintf(record, "%s: %s\r\n", name, value)
+		}
+	}
+	record.WriteString("\r\n")
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+
+	compressed := &bytes.Buffer{}
+	gz := gzip.NewWriter(compressed)
+	if _, err := gz.Write(record.Bytes()); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	n, err := w.file.Write(compressed.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+func (w *warcWriter) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// close closes the current file.
+func (w *warcWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.closeFile()
+}
+
+// writeHTTPRequestHead writes the request line and headers of a request.
+func writeHTTPRequestHead(buf *bytes.Buffer, req *http.Request) {
+	fmt.Fprintf(buf, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(buf, "Host: %s\r\n", host)
+	_ = req.Header.Write(buf)
+	buf.WriteString("\r\n")
+}
+
+// writeHTTPResponseHead writes the status line and headers of a response.
+// The body was already decoded by the HTTP client, the encoding headers
+// are removed and the content length is set to the decoded length.
+func writeHTTPResponseHead(buf *bytes.Buffer, resp *http.Response, bodyLength int) {
+	fmt.Fprintf(buf, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	header := resp.Header.Clone()
+	header.Del("Content-Encoding")
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(bodyLength))
+	_ = header.Write(buf)
+	buf.WriteString("\r\n")
+}
+
+func warcDigest(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func formatWARCDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// newRecordID returns a random UUID based record ID.
+func newRecordID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,228 @@
+package scraper
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// readWARCRecords reads all records of a WARC file and returns the headers
+// and blocks of the records.
+func readWARCRecords(t *testing.T, fileName string) ([]http.Header, []string) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		t.Fatalf("Opening WARC file failed: %v", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Opening gzip reader failed: %v", err)
+	}
+	r := bufio.NewReader(gz)
+
+	var headers []http.Header
+	var blocks []string
+	for {
+		version, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil || version != "WARC/1.1\r\n" {
+			t.Fatalf("Invalid record version line %q: %v", version, err)
+		}
+
+		h := make(http.Header)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Reading record header failed: %v", err)
+			}
+			if line == "\r\n" {
+				break
+			}
+			sl := strings.SplitN(strings.TrimSpace(line), ": ", 2)
+			h.Set(sl[0], sl[1])
+		}
+
+		length, _ := strconv.Atoi(h.Get("Content-Length"))
+		block := make([]byte, length+4)
+		if _, err = io.ReadFull(r, block); err != nil {
+			t.Fatalf("Reading record block failed: %v", err)
+		}
+		if string(block[length:]) != "\r\n\r\n" {
+			t.Fatal("Record block is not terminated correctly")
+		}
+
+		headers = append(headers, h)
+		blocks = append(blocks, string(block[:length]))
+	}
+	return headers, blocks
+}
+
+func TestWARCWriter(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	w := newWARCWriter(filepath.Join(dir, "test"), 1, "testbot")
+
+	u, _ := url.Parse("http://example.com/page?x=1")
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    u,
+		Header: http.Header{"User-Agent": []string{"testbot"}},
+	}
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type":     []string{"text/html"},
+			"Content-Encoding": []string{"gzip"},
+		},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := w.writeExchange(req, resp, []byte("<html></html>")); err != nil {
+			t.Fatalf("Writing exchange failed: %v", err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatalf("Closing WARC writer failed: %v", err)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "test-*.warc.gz"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("WARC files were not rotated: %v %v", files, err)
+	}
+
+	headers, blocks := readWARCRecords(t, files[0])
+	if len(headers) != 3 {
+		t.Fatalf("WARC file should contain 3 records but contained %d", len(headers))
+	}
+
+	var types []string
+	for _, h := range headers {
+		types = append(types, h.Get("WARC-Type"))
+	}
+	if strings.Join(types, ",") != "warcinfo,response,request" {
+		t.Errorf("Unexpected record types %v", types)
+	}
+
+	if headers[2].Get("WARC-Concurrent-To") != headers[1].Get("WARC-Record-ID") {
+		t.Error("Request record does not refer to the response record")
+	}
+	if headers[1].Get("WARC-Target-URI") != u.String() {
+		t.Errorf("Unexpected target URI %s", headers[1].Get("WARC-Target-URI"))
+	}
+
+	expectedResponse := "HTTP/1.1 200 OK\r\nContent-Length: 13\r\nContent-Type: text/html\r\n\r\n<html></html>"
+	if blocks[1] != expectedResponse {
+		t.Errorf("Unexpected response block %q", blocks[1])
+	}
+	expectedRequest := "GET /page?x=1 HTTP/1.1\r\nHost: example.com\r\nUser-Agent: testbot\r\n\r\n"
+	if blocks[2] != expectedRequest {
+		t.Errorf("Unexpected request block %q", blocks[2])
+	}
+}
+
+func TestWARCOutput(t *testing.T) {
+	site := testSite{
+		"/": `<html><body><script src="app.js"></script><script src="old.js"></script>
+			<img src="missing.png"></body></html>`,
+		"/app.js": "app",
+	}
+	var mu sync.Mutex
+	var received http.Header
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/app.js" {
+			mu.Lock()
+			received = r.Header
+			mu.Unlock()
+		}
+		if r.URL.Path == "/old.js" {
+			http.Redirect(w, r, "/app.js", http.StatusMovedPermanently)
+			return
+		}
+		site.ServeHTTP(w, r)
+	})
+
+	output := tempDir(t)
+	defer os.RemoveAll(output)
+	cfg := Config{
+		WARCPrefix: filepath.Join(output, "archive"),
+	}
+	// the missing image fails the scrape
+	_, _ = scrapeFailingTestSite(t, handler, cfg, output)
+
+	files, err := filepath.Glob(filepath.Join(output, "archive-*.warc.gz"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("WARC file was not written: %v %v", files, err)
+	}
+
+	headers, blocks := readWARCRecords(t, files[0])
+	responses := make(map[string]string)
+	requests := make(map[string]string)
+	for i, h := range headers {
+		switch h.Get("WARC-Type") {
+		case "response":
+			responses[h.Get("WARC-Target-URI")] = blocks[i]
+		case "request":
+			requests[h.Get("WARC-Target-URI")] = blocks[i]
+		}
+	}
+	if len(responses) != 5 {
+		t.Fatalf("WARC file should contain 5 responses but contained %d", len(responses))
+	}
+	// responses with unexpected status codes and redirects of assets are
+	// archived as well
+	var expected = map[string]string{
+		"/robots.txt":  "HTTP/1.1 404 Not Found\r\n",
+		"/missing.png": "HTTP/1.1 404 Not Found\r\n",
+		"/old.js":      "HTTP/1.1 301 Moved Permanently\r\n",
+		"/app.js":      "HTTP/1.1 200 OK\r\n",
+	}
+	for target, block := range responses {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatalf("Parsing target URI failed: %v", err)
+		}
+		if status, ok := expected[u.Path]; ok && !strings.HasPrefix(block, status) {
+			t.Errorf("Response block of %s should start with %q but was %q", target, status, block)
+		}
+		if u.Path == "/app.js" && !strings.HasSuffix(block, "\r\n\r\napp") {
+			t.Errorf("Unexpected response block for %s: %q", target, block)
+		}
+	}
+
+	// the request records contain the headers that were sent, including
+	// the encoding that the transport requests itself
+	mu.Lock()
+	defer mu.Unlock()
+	if received.Get("Accept-Encoding") == "" {
+		t.Fatal("Request of app.js did not ask for an encoding")
+	}
+	for target, block := range requests {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatalf("Parsing target URI failed: %v", err)
+		}
+		if u.Path != "/app.js" {
+			continue
+		}
+		for name := range received {
+			if line := name + ": " + received.Get(name) + "\r\n"; !strings.Contains(block, line) {
+				t.Errorf("Request block of %s should contain %q but was %q", target, line, block)
+			}
+		}
+	}
+}